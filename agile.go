@@ -0,0 +1,248 @@
+package libgojira
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Representation of an agile sprint
+type Sprint struct {
+	Id        int
+	Name      string
+	State     string
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+func (s *Sprint) String() string {
+	return fmt.Sprintf("%d: %s (%s)", s.Id, s.Name, s.State)
+}
+
+func (jc *JiraClient) agileUrl() string {
+	return fmt.Sprintf("%s/rest/agile/1.0", jc.baseUrl())
+}
+
+//Representation of an agile board
+type Board struct {
+	Id         int
+	Name       string
+	Type       string //scrum or kanban
+	ProjectKey string
+}
+
+func (b *Board) String() string {
+	return fmt.Sprintf("%d: %s (%s)", b.Id, b.Name, b.Type)
+}
+
+//Lists the agile boards. Passing a project key or id only lists the boards of that project.
+func (jc *JiraClient) GetBoards(projectKeyOrId ...string) ([]Board, error) {
+	u := fmt.Sprintf("%s/board", jc.agileUrl())
+	if len(projectKeyOrId) > 0 && projectKeyOrId[0] != "" {
+		u += "?projectKeyOrId=" + url.QueryEscape(projectKeyOrId[0])
+	}
+	values, err := jc.fetchAllPages(u, "values")
+	if err != nil {
+		return nil, err
+	}
+	result := []Board{}
+	for _, v := range values {
+		result = append(result, boardFromIface(v))
+	}
+	return result, nil
+}
+
+//Fetches a single board.
+func (jc *JiraClient) GetBoard(boardID int) (*Board, error) {
+	obj, err := jc.getJson(fmt.Sprintf("%s/board/%d", jc.agileUrl(), boardID))
+	if err != nil {
+		return nil, err
+	}
+	board := boardFromIface(obj)
+	return &board, nil
+}
+
+func boardFromIface(obj interface{}) Board {
+	idjs, _ := jsonWalker("id", obj)
+	namejs, _ := jsonWalker("name", obj)
+	typejs, _ := jsonWalker("type", obj)
+	projjs, _ := jsonWalker("location/projectKey", obj)
+	board := Board{}
+	id, _ := idjs.(float64)
+	board.Id = int(id)
+	board.Name, _ = namejs.(string)
+	board.Type, _ = typejs.(string)
+	board.ProjectKey, _ = projjs.(string)
+	return board
+}
+
+//Lists all the sprints of a board.
+func (jc *JiraClient) GetSprints(boardID int) ([]Sprint, error) {
+	values, err := jc.fetchAllPages(fmt.Sprintf("%s/board/%d/sprint", jc.agileUrl(), boardID), "values")
+	if err != nil {
+		return nil, err
+	}
+	result := []Sprint{}
+	for _, v := range values {
+		result = append(result, sprintFromIface(v))
+	}
+	return result, nil
+}
+
+func sprintFromIface(obj interface{}) Sprint {
+	idjs, _ := jsonWalker("id", obj)
+	namejs, _ := jsonWalker("name", obj)
+	statejs, _ := jsonWalker("state", obj)
+	startjs, _ := jsonWalker("startDate", obj)
+	endjs, _ := jsonWalker("endDate", obj)
+	sprint := Sprint{}
+	id, _ := idjs.(float64)
+	sprint.Id = int(id)
+	sprint.Name, _ = namejs.(string)
+	sprint.State, _ = statejs.(string)
+	if start, ok := startjs.(string); ok {
+		sprint.StartDate, _ = time.Parse(time.RFC3339, start)
+	}
+	if end, ok := endjs.(string); ok {
+		sprint.EndDate, _ = time.Parse(time.RFC3339, end)
+	}
+	return sprint
+}
+
+//Matches the keys of the legacy sprint format,
+//e.g. "com.atlassian.greenhopper.service.sprint.Sprint@1f[id=12,rapidViewId=3,state=ACTIVE,name=Sprint 5,...]"
+var legacysprintkeyregex *regexp.Regexp = regexp.MustCompile(`[\[,](\w+)=`)
+
+//Parses the value of the sprint custom field, picking the active sprint when there's one.
+func sprintFromField(value interface{}) *Sprint {
+	values, _ := value.([]interface{})
+	var result *Sprint
+	for _, v := range values {
+		var sprint Sprint
+		if legacy, ok := v.(string); ok {
+			sprint = legacySprintFromString(legacy)
+		} else {
+			sprint = sprintFromIface(v)
+		}
+		result = &sprint
+		if strings.ToLower(sprint.State) == "active" {
+			break
+		}
+	}
+	return result
+}
+
+func legacySprintFromString(s string) Sprint {
+	s = strings.TrimSuffix(s, "]")
+	attrs := map[string]string{}
+	matches := legacysprintkeyregex.FindAllStringSubmatchIndex(s, -1)
+	for i, m := range matches {
+		end := len(s)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		attrs[s[m[2]:m[3]]] = s[m[1]:end]
+	}
+	sprint := Sprint{}
+	sprint.Id, _ = strconv.Atoi(attrs["id"])
+	sprint.Name = attrs["name"]
+	sprint.State = strings.ToLower(attrs["state"])
+	sprint.StartDate, _ = time.Parse(time.RFC3339, attrs["startDate"])
+	sprint.EndDate, _ = time.Parse(time.RFC3339, attrs["endDate"])
+	return sprint
+}
+
+//Lists all the issues in a sprint.
+func (jc *JiraClient) GetSprintIssues(sprintID int) ([]*Issue, error) {
+	return jc.agileIssues(fmt.Sprintf("%s/sprint/%d/issue", jc.agileUrl(), sprintID))
+}
+
+//Fetches all the pages of an agile issue listing.
+func (jc *JiraClient) agileIssues(u string) ([]*Issue, error) {
+	issues, err := jc.fetchAllPages(u+"?fields=*all", "issues")
+	if err != nil {
+		return nil, err
+	}
+	return jc.issuesFromIface(issues), nil
+}
+
+//Error returned when Jira refuses to move some of the issues.
+type IssuesRejectedError struct {
+	Keys []string
+	Err  *ApiError
+}
+
+func (ire *IssuesRejectedError) Error() string {
+	return fmt.Sprintf("Issues rejected (%s): %s", strings.Join(ire.Keys, ", "), ire.Err.Error())
+}
+
+//Moves issues into a sprint.
+func (jc *JiraClient) MoveIssuesToSprint(sprintID int, issueKeys []string) error {
+	return jc.moveIssues(fmt.Sprintf("%s/sprint/%d/issue", jc.agileUrl(), sprintID), issueKeys)
+}
+
+//Moves issues back to the backlog, removing them from any sprint.
+func (jc *JiraClient) MoveIssuesToBacklog(issueKeys []string) error {
+	return jc.moveIssues(fmt.Sprintf("%s/backlog/issue", jc.agileUrl()), issueKeys)
+}
+
+func (jc *JiraClient) moveIssues(u string, issueKeys []string) error {
+	b, err := json.Marshal(msi{"issues": issueKeys})
+	if err != nil {
+		return err
+	}
+	resp, err := jc.Post(u, "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	ae := newApiError(resp, "Could not move issues")
+	//Jira names the faulty issues in its error messages.
+	rejected := []string{}
+	for _, k := range issueKeys {
+		keyregex := regexp.MustCompile(`\b` + regexp.QuoteMeta(k) + `\b`)
+		for _, m := range ae.ErrorMessages {
+			if keyregex.MatchString(m) {
+				rejected = append(rejected, k)
+				break
+			}
+		}
+	}
+	if len(rejected) > 0 {
+		return &IssuesRejectedError{rejected, ae}
+	}
+	return ae
+}
+
+//Lists all the issues belonging to an epic.
+func (jc *JiraClient) GetEpicIssues(epicKey string) ([]*Issue, error) {
+	return jc.agileIssues(fmt.Sprintf("%s/epic/%s/issue", jc.agileUrl(), epicKey))
+}
+
+//Puts issues under an epic.
+//On Cloud the epic is set as the issues' parent, which works for both classic
+//and next-gen projects. On Server the agile epic endpoint sets the epic link.
+func (jc *JiraClient) AddIssuesToEpic(epicKey string, issueKeys []string) error {
+	si, err := jc.GetServerInfo()
+	if err != nil {
+		return err
+	}
+	if !si.IsCloud() {
+		return jc.moveIssues(fmt.Sprintf("%s/epic/%s/issue", jc.agileUrl(), epicKey), issueKeys)
+	}
+	for _, k := range issueKeys {
+		err := jc.UpdateIssue(k, msi{"parent": []interface{}{msi{"set": msi{"key": epicKey}}}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
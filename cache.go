@@ -0,0 +1,135 @@
+package libgojira
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultMetaCacheTTL = 5 * time.Minute
+
+//Thread-safe cache of parsed json responses, keyed by url.
+type metaCache struct {
+	sync.Mutex
+	entries map[string]metaCacheEntry
+}
+
+type metaCacheEntry struct {
+	obj     interface{}
+	fetched time.Time
+}
+
+func newMetaCache() *metaCache {
+	return &metaCache{entries: map[string]metaCacheEntry{}}
+}
+
+func (mc *metaCache) get(key string, ttl time.Duration) (interface{}, bool) {
+	mc.Lock()
+	defer mc.Unlock()
+	entry, ok := mc.entries[key]
+	if !ok || time.Since(entry.fetched) > ttl {
+		return nil, false
+	}
+	return entry.obj, true
+}
+
+func (mc *metaCache) set(key string, obj interface{}) {
+	mc.Lock()
+	defer mc.Unlock()
+	mc.entries[key] = metaCacheEntry{obj, time.Now()}
+}
+
+func (mc *metaCache) clear() {
+	mc.Lock()
+	defer mc.Unlock()
+	mc.entries = map[string]metaCacheEntry{}
+}
+
+func (mc *metaCache) clearPrefix(prefix string) {
+	mc.Lock()
+	defer mc.Unlock()
+	for k := range mc.entries {
+		if strings.HasPrefix(k, prefix) {
+			delete(mc.entries, k)
+		}
+	}
+}
+
+//Cache of parsed issues along with the validators Jira sent for them.
+type issueCache struct {
+	sync.Mutex
+	size    int
+	entries map[string]issueCacheEntry
+	order   []string
+}
+
+type issueCacheEntry struct {
+	issue        *Issue
+	etag         string
+	lastModified string
+}
+
+const defaultIssueCacheSize = 100
+
+func newIssueCache(size int) *issueCache {
+	if size <= 0 {
+		size = defaultIssueCacheSize
+	}
+	return &issueCache{size: size, entries: map[string]issueCacheEntry{}}
+}
+
+func (ic *issueCache) get(key string) (issueCacheEntry, bool) {
+	ic.Lock()
+	defer ic.Unlock()
+	entry, ok := ic.entries[key]
+	return entry, ok
+}
+
+func (ic *issueCache) set(key string, entry issueCacheEntry) {
+	ic.Lock()
+	defer ic.Unlock()
+	if _, ok := ic.entries[key]; !ok {
+		ic.order = append(ic.order, key)
+	}
+	ic.entries[key] = entry
+	//Evict the oldest entries once over the cap.
+	for len(ic.order) > ic.size {
+		delete(ic.entries, ic.order[0])
+		ic.order = ic.order[1:]
+	}
+}
+
+func (ic *issueCache) remove(key string) {
+	ic.Lock()
+	defer ic.Unlock()
+	delete(ic.entries, key)
+	for i, k := range ic.order {
+		if k == key {
+			ic.order = append(ic.order[:i], ic.order[i+1:]...)
+			break
+		}
+	}
+}
+
+//Small thread-safe string to string cache, for lookups that don't expire.
+type stringCache struct {
+	sync.Mutex
+	entries map[string]string
+}
+
+func newStringCache() *stringCache {
+	return &stringCache{entries: map[string]string{}}
+}
+
+func (sc *stringCache) get(key string) (string, bool) {
+	sc.Lock()
+	defer sc.Unlock()
+	v, ok := sc.entries[key]
+	return v, ok
+}
+
+func (sc *stringCache) set(key, value string) {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.entries[key] = value
+}
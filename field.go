@@ -0,0 +1,147 @@
+package libgojira
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+//Description of an issue field, system or custom.
+type Field struct {
+	Id           string
+	Name         string
+	Custom       bool
+	SchemaType   string //e.g. "number", "array"
+	SchemaItems  string //Type of the elements of array fields
+	SchemaCustom string //Custom field type, e.g. "com.pyxis.greenhopper.jira:gh-sprint"
+}
+
+func (f *Field) String() string {
+	return fmt.Sprintf("%s: %s", f.Id, f.Name)
+}
+
+//Lists all the fields of the instance, mapping custom field ids to their names.
+//The list is kept in the metadata cache.
+func (jc *JiraClient) GetFields() ([]Field, error) {
+	obj, err := jc.cachedGet(fmt.Sprintf("%s/field", jc.apiUrl()))
+	if err != nil {
+		return nil, err
+	}
+	result := []Field{}
+	fields, _ := obj.([]interface{})
+	for _, f := range fields {
+		idjs, _ := jsonWalker("id", f)
+		namejs, _ := jsonWalker("name", f)
+		customjs, _ := jsonWalker("custom", f)
+		typejs, _ := jsonWalker("schema/type", f)
+		itemsjs, _ := jsonWalker("schema/items", f)
+		schemacustomjs, _ := jsonWalker("schema/custom", f)
+		field := Field{}
+		field.Id, _ = idjs.(string)
+		field.Name, _ = namejs.(string)
+		field.Custom, _ = customjs.(bool)
+		field.SchemaType, _ = typejs.(string)
+		field.SchemaItems, _ = itemsjs.(string)
+		field.SchemaCustom, _ = schemacustomjs.(string)
+		result = append(result, field)
+	}
+	return result, nil
+}
+
+//Finds the id of the custom field of the given schema type, e.g. "com.pyxis.greenhopper.jira:gh-sprint".
+//Empty when there's none.
+func fieldIdBySchema(fields []Field, schemaType string) string {
+	for _, f := range fields {
+		if f.SchemaCustom == schemaType {
+			return f.Id
+		}
+	}
+	return ""
+}
+
+//Finds the id of a custom field by its name, ignoring case. Empty when there's none.
+func fieldIdByName(fields []Field, names ...string) string {
+	for _, name := range names {
+		for _, f := range fields {
+			if f.Custom && strings.EqualFold(f.Name, name) {
+				return f.Id
+			}
+		}
+	}
+	return ""
+}
+
+//Ids of the custom fields every parsed issue reads, looked up once per client.
+//Fields the instance doesn't have are remembered as empty ids, failed lookups
+//are retried on the next call.
+type customFieldIds struct {
+	sync.Mutex
+	done        bool
+	sprint      string
+	storyPoints string
+}
+
+//Returns the sprint and story points field ids, empty when the instance has none.
+func (jc *JiraClient) customFieldIds() (sprint, storyPoints string, err error) {
+	ids := jc.fieldIds
+	ids.Lock()
+	defer ids.Unlock()
+	if !ids.done {
+		fields, err := jc.GetFields()
+		if err != nil {
+			if jc.options.Verbose {
+				fmt.Println(err)
+			}
+			return "", "", err
+		}
+		ids.done = true
+		ids.sprint = fieldIdBySchema(fields, "com.pyxis.greenhopper.jira:gh-sprint")
+		ids.storyPoints = fieldIdByName(fields, "Story Points", "Story point estimate")
+	}
+	return ids.sprint, ids.storyPoints, nil
+}
+
+func (ids *customFieldIds) reset() {
+	ids.Lock()
+	defer ids.Unlock()
+	ids.done = false
+	ids.sprint, ids.storyPoints = "", ""
+}
+
+//Custom fields read when parsing issues
+type issueFieldIds struct {
+	sprint      string
+	storyPoints string
+}
+
+//Resolves the custom fields to read when parsing issues, from the options
+//first, looking up the ones they don't set. Unknown fields are left empty.
+func (jc *JiraClient) issueFieldIds() issueFieldIds {
+	ids := issueFieldIds{jc.options.SprintField, jc.options.StoryPointsField}
+	if ids.sprint == "" || ids.storyPoints == "" {
+		sprint, storyPoints, _ := jc.customFieldIds()
+		if ids.sprint == "" {
+			ids.sprint = sprint
+		}
+		if ids.storyPoints == "" {
+			ids.storyPoints = storyPoints
+		}
+	}
+	return ids
+}
+
+//Sets the story points estimate of an issue.
+func (jc *JiraClient) SetStoryPoints(issueKey string, points float64) error {
+	field := jc.options.StoryPointsField
+	if field == "" {
+		_, storyPoints, err := jc.customFieldIds()
+		if err != nil {
+			return err
+		}
+		if storyPoints == "" {
+			return &JiraClientError{"Story points field not found, set Options.StoryPointsField"}
+		}
+		field = storyPoints
+	}
+	return jc.UpdateIssueFields(issueKey, msi{field: points}, nil)
+}
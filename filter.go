@@ -0,0 +1,101 @@
+package libgojira
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+//A saved search
+type Filter struct {
+	Id          string
+	Name        string
+	Description string
+	Owner       string
+	Jql         string
+	Favourite   bool
+	ViewUrl     string
+}
+
+func (f *Filter) String() string {
+	return fmt.Sprintf("%s: %s (%s)", f.Id, f.Name, f.Jql)
+}
+
+//Fetches a saved filter.
+func (jc *JiraClient) GetFilter(id string) (*Filter, error) {
+	obj, err := jc.getJson(fmt.Sprintf("%s/filter/%s", jc.apiUrl(), url.PathEscape(id)))
+	if err != nil {
+		return nil, err
+	}
+	filter := filterFromIface(obj)
+	return &filter, nil
+}
+
+//Runs the search of a saved filter.
+func (jc *JiraClient) SearchByFilter(id string) ([]*Issue, error) {
+	filter, err := jc.GetFilter(id)
+	if err != nil {
+		return nil, err
+	}
+	return jc.Search(&SearchOptions{JQL: url.QueryEscape(filter.Jql)})
+}
+
+//Lists the filters owned by the current user.
+func (jc *JiraClient) ListMyFilters() ([]Filter, error) {
+	obj, err := jc.getJson(fmt.Sprintf("%s/filter/my", jc.apiUrl()))
+	if err != nil {
+		return nil, err
+	}
+	result := []Filter{}
+	filters, _ := obj.([]interface{})
+	for _, f := range filters {
+		result = append(result, filterFromIface(f))
+	}
+	return result, nil
+}
+
+//Saves a search as a filter and returns its id.
+func (jc *JiraClient) CreateFilter(name, jql string, favourite bool) (string, error) {
+	b, err := json.Marshal(msi{"name": name, "jql": jql, "favourite": favourite})
+	if err != nil {
+		return "", err
+	}
+	u := fmt.Sprintf("%s/filter", jc.apiUrl())
+	if jc.dryRun("POST", u, b) {
+		return "", nil
+	}
+	resp, err := jc.Post(u, "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", newApiError(resp, "Could not create filter")
+	}
+	obj, err := JsonToInterface(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	filter := filterFromIface(obj)
+	return filter.Id, nil
+}
+
+func filterFromIface(obj interface{}) Filter {
+	idjs, _ := jsonWalker("id", obj)
+	namejs, _ := jsonWalker("name", obj)
+	descjs, _ := jsonWalker("description", obj)
+	ownerjs, _ := jsonWalker("owner/displayName", obj)
+	jqljs, _ := jsonWalker("jql", obj)
+	favjs, _ := jsonWalker("favourite", obj)
+	viewjs, _ := jsonWalker("viewUrl", obj)
+	filter := Filter{}
+	filter.Id, _ = idjs.(string)
+	filter.Name, _ = namejs.(string)
+	filter.Description, _ = descjs.(string)
+	filter.Owner, _ = ownerjs.(string)
+	filter.Jql, _ = jqljs.(string)
+	filter.Favourite, _ = favjs.(bool)
+	filter.ViewUrl, _ = viewjs.(string)
+	return filter
+}
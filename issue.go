@@ -10,6 +10,9 @@ import (
 	"os/exec"
 	"regexp"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 )
 
 //Representation of a single issue
@@ -17,19 +20,68 @@ type Issue struct {
 	Key               string
 	Type              string
 	Summary           string
-	Parent            string
+	Parent            string //Key of the parent issue, empty when there's none
 	Description       string
 	Status            string
 	Assignee          string
+	Reporter          string
 	Files             IssueFileList
 	OriginalEstimate  float64
 	RemainingEstimate float64
 	TimeSpent         float64
 	Comments          CommentList
 	TimeLog           TimeLogMap
-	Updated           string
+	Created           time.Time
+	Updated           time.Time
+	DueDate           *time.Time //Nil when no due date is set
 	Points            string
+	StoryPoints       float64
+	WatchCount        int
+	Sprint            *Sprint //Active sprint, or the last one the issue was in, nil without sprint
 	SubTasks          []*Issue
+
+	raw map[string]interface{} //All the fields, as sent by Jira
+}
+
+//Reads any field of the issue by id, typically a "customfield_XXXXX".
+//The value is the untyped json Jira sent.
+func (i *Issue) CustomField(id string) (interface{}, bool) {
+	v, ok := i.raw[id]
+	return v, ok
+}
+
+//Fills creation options from the issue, to create a similar one.
+//Type, summary, description, labels, components, priority and parent carry over,
+//the type as the friendly name CreateTask expects, e.g. "user-story".
+//Status, key, assignee, timestamps, estimates, comments, attachments and
+//custom fields don't round-trip and are left for the caller to set.
+func (i *Issue) ToNewTaskOptions() *NewTaskOptions {
+	nto := &NewTaskOptions{
+		TaskType:    strings.Replace(strings.ToLower(i.Type), " ", "-", -1),
+		Summary:     i.Summary,
+		Description: i.Description,
+	}
+	if i.Parent != "" {
+		nto.Parent = &Issue{Key: i.Parent}
+	}
+	if labels, ok := i.raw["labels"].([]interface{}); ok {
+		for _, l := range labels {
+			if label, ok := l.(string); ok {
+				nto.Labels = append(nto.Labels, label)
+			}
+		}
+	}
+	if components, ok := i.raw["components"].([]interface{}); ok {
+		for _, c := range components {
+			namejs, _ := jsonWalker("name", c)
+			if name, ok := namejs.(string); ok {
+				nto.Components = append(nto.Components, name)
+			}
+		}
+	}
+	priorityjs, _ := jsonWalker("priority/name", i.raw)
+	nto.Priority, _ = priorityjs.(string)
+	return nto
 }
 
 func (i *Issue) QRCodeBase64() string {
@@ -49,7 +101,7 @@ func (i *Issue) QRCodeBase64() string {
 
 func (i *Issue) ETag() string {
 	hash := sha256.New()
-	io.WriteString(hash, i.Updated)
+	io.WriteString(hash, i.Updated.Format(JIRA_TIME_FORMAT))
 	return string(hash.Sum(nil))
 }
 
@@ -70,9 +122,12 @@ func (i *Issue) TaskTransition(jc *JiraClient, transition string, extra_fields m
 type CommentList []*Comment
 
 type Comment struct {
-	Id         string
-	Body       string
-	AuthorName string
+	Id           string
+	Body         string
+	RenderedBody string //Html rendering of Body, only set with Options.RenderComments
+	AuthorName   string
+	AuthorId     string //Account id on Cloud, user name on Server
+	Created      time.Time
 }
 
 func (cm *Comment) String() string {
@@ -93,6 +148,21 @@ type IssueFile struct {
 	name string
 	url  string
 	self string
+
+	Id        string
+	Size      int64 //In bytes
+	MimeType  string
+	Author    string
+	Created   time.Time
+	Thumbnail string //Url of the thumbnail, only set for images
+}
+
+func (issf *IssueFile) Name() string {
+	return issf.name
+}
+
+func (issf *IssueFile) Url() string {
+	return issf.url
 }
 
 func (issf *IssueFile) String() string {
@@ -115,8 +185,34 @@ func (i *Issue) String() string {
 	return fmt.Sprintf("%s (%s%s): %s", i.Key, i.Type, p, i.Summary)
 }
 
+func (i *Issue) OriginalEstimateDuration() time.Duration {
+	return time.Duration(i.OriginalEstimate * float64(time.Second))
+}
+
+func (i *Issue) RemainingEstimateDuration() time.Duration {
+	return time.Duration(i.RemainingEstimate * float64(time.Second))
+}
+
+func (i *Issue) TimeSpentDuration() time.Duration {
+	return time.Duration(i.TimeSpent * float64(time.Second))
+}
+
+//Renders the issue through a text/template, e.g. "{{.Key}} [{{.Type}}] {{.Summary}} ({{.Status}}, {{.Assignee}})".
+func (i *Issue) Format(format string) (string, error) {
+	tpl, err := template.New("issue").Parse(format)
+	if err != nil {
+		return "", err
+	}
+	buf := bytes.NewBuffer([]byte{})
+	err = tpl.Execute(buf, i)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
 func (i *Issue) Url() string {
-	return fmt.Sprintf("https://%s/browse/%s", Server, i.Key)
+	return fmt.Sprintf("%s/browse/%s", serverUrl(Server), i.Key)
 }
 
 var Server string
@@ -162,10 +258,11 @@ func (i *Issue) Assign(author string, jc *JiraClient) error {
 	if err != nil {
 		return err
 	}
-	resp, err := jc.Put(fmt.Sprintf("https://%s/rest/api/2/issue/%s/assignee", jc.options.Server, i.Key), "application/json", bytes.NewBuffer(js))
+	resp, err := jc.Put(fmt.Sprintf("%s/issue/%s/assignee", jc.apiUrl(), i.Key), "application/json", bytes.NewBuffer(js))
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != 204 {
 		s, _ := ioutil.ReadAll(resp.Body)
 		return &IssueError{fmt.Sprintf("%d: %s", resp.StatusCode, string(s))}
@@ -229,10 +326,11 @@ func (r Resolutions) String() string {
 }
 
 func (i *Issue) PossibleResolutions(jc *JiraClient) (Resolutions, error) {
-	resp, err := jc.Get(fmt.Sprintf("https://%s/rest/api/2/issue/%s/transitions?expand=transitions.fields", jc.Server, i.Key))
+	resp, err := jc.Get(fmt.Sprintf("%s/issue/%s/transitions?expand=transitions.fields", jc.apiUrl(), i.Key))
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	obj, err := JsonToInterface(resp.Body)
 	if err != nil {
 		return nil, err
@@ -272,11 +370,27 @@ func (i *Issue) ResolveIssue(jc *JiraClient, resolution string) error {
 }
 
 func (i *Issue) doTransitionWithFields(id string, fields interface{}, jc *JiraClient) error {
-	putJs, err := json.Marshal(map[string]interface{}{"transition": map[string]interface{}{"id": id}, "fields": fields})
+	return i.doTransitionWithUpdate(id, fields, nil, jc)
+}
+
+func (i *Issue) doTransitionWithUpdate(id string, fields interface{}, update msi, jc *JiraClient) error {
+	body := map[string]interface{}{"transition": map[string]interface{}{"id": id}, "fields": fields}
+	if update != nil {
+		body["update"] = update
+	}
+	putJs, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf("%s/issue/%s/transitions", jc.apiUrl(), i.Key)
+	if jc.dryRun("POST", u, putJs) {
+		return nil
+	}
+	resp, err := jc.Post(u, "application/json", bytes.NewBuffer(putJs))
 	if err != nil {
 		return err
 	}
-	resp, err := jc.Post(fmt.Sprintf("https://%s/rest/api/2/issue/%s/transitions", jc.options.Server, i.Key), "application/json", bytes.NewBuffer(putJs))
+	defer resp.Body.Close()
 	if resp.StatusCode != 204 {
 		s, _ := ioutil.ReadAll(resp.Body)
 		return &IssueError{fmt.Sprintf("%d: %s", resp.StatusCode, string(s))}
@@ -290,10 +404,11 @@ func (i *Issue) doTransition(id string, jc *JiraClient) error {
 }
 
 func (i *Issue) getTransitionId(transition string, jc *JiraClient) (string, error) {
-	resp, err := jc.Get(fmt.Sprintf("https://%s/rest/api/2/issue/%s/transitions", jc.options.Server, i.Key))
+	resp, err := jc.Get(fmt.Sprintf("%s/issue/%s/transitions", jc.apiUrl(), i.Key))
 	if err != nil {
 		return "", err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
 		s, _ := ioutil.ReadAll(resp.Body)
 		return "", &IssueError{fmt.Sprintf("%d: %s", resp.StatusCode, string(s))}
@@ -318,6 +433,142 @@ func (i *Issue) getTransitionId(transition string, jc *JiraClient) (string, erro
 
 }
 
+//A workflow transition available on an issue
+type Transition struct {
+	Id     string
+	Name   string
+	To     Status      //Status the issue ends up in
+	Fields []FieldMeta //Fields on the transition screen, only set when expanded
+}
+
+func (t *Transition) String() string {
+	return fmt.Sprintf("%s: %s -> %s", t.Id, t.Name, t.To.Name)
+}
+
+//Lists the transitions currently available on an issue.
+//expandFields also fetches the fields each transition's screen has.
+func (jc *JiraClient) GetTransitions(issueKey string, expandFields bool) ([]Transition, error) {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("%s/%s/transitions", jc.issueUrl(), issueKey)
+	if expandFields {
+		u += "?expand=transitions.fields"
+	}
+	obj, err := jc.getJson(u)
+	if err != nil {
+		return nil, err
+	}
+	txsjs, _ := jsonWalker("transitions", obj)
+	txs, _ := txsjs.([]interface{})
+	result := []Transition{}
+	for _, tx := range txs {
+		idjs, _ := jsonWalker("id", tx)
+		namejs, _ := jsonWalker("name", tx)
+		tojs, _ := jsonWalker("to", tx)
+		t := Transition{To: statusFromIface(tojs)}
+		t.Id, _ = idjs.(string)
+		t.Name, _ = namejs.(string)
+		fieldsjs, _ := jsonWalker("fields", tx)
+		if fields, ok := fieldsjs.(map[string]interface{}); ok {
+			t.Fields = fieldMetasFromIface(fields)
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+//Lists the fields that must be provided to perform the transition.
+//Only known when the transition was fetched with its fields expanded.
+func (t *Transition) RequiredFields() []FieldMeta {
+	result := []FieldMeta{}
+	for _, f := range t.Fields {
+		if f.Required && !f.HasDefault {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+//Moves an issue through the transition named transitionName (or with that id).
+//Fields required by the transition screen are checked before posting, so a missing
+//field yields an error naming it instead of an opaque 400.
+func (jc *JiraClient) DoTransition(issueKey, transitionName string, fields map[string]interface{}) error {
+	return jc.transition(issueKey, transitionName, fields, nil)
+}
+
+//Moves an issue through a transition and comments on it in the same request,
+//so the issue can't end up transitioned without its comment.
+func (jc *JiraClient) TransitionWithComment(issueKey, transitionName, comment string) error {
+	return jc.transition(issueKey, transitionName, nil, msi{"comment": []interface{}{msi{"add": msi{"body": jc.textBody(comment)}}}})
+}
+
+func (jc *JiraClient) transition(issueKey, transitionName string, fields, update msi) error {
+	txs, err := jc.GetTransitions(issueKey, true)
+	if err != nil {
+		return err
+	}
+	var tx *Transition
+	for k := range txs {
+		if txs[k].Id == transitionName || strings.EqualFold(txs[k].Name, transitionName) {
+			tx = &txs[k]
+			break
+		}
+	}
+	if tx == nil {
+		return newIssueError(fmt.Sprintf("Transition %s not available on %s", transitionName, issueKey))
+	}
+	missing := []string{}
+	for _, f := range tx.RequiredFields() {
+		_, inFields := fields[f.Id]
+		_, inUpdate := update[f.Id]
+		if !inFields && !inUpdate {
+			missing = append(missing, fmt.Sprintf("%s (%s)", f.Name, f.Id))
+		}
+	}
+	if len(missing) > 0 {
+		return newIssueError(fmt.Sprintf("Transition %s requires fields: %s", tx.Name, strings.Join(missing, ", ")))
+	}
+	i := &Issue{Key: issueKey}
+	return i.doTransitionWithUpdate(tx.Id, fields, update, jc)
+}
+
+//How many transitions DoTransitionBatch runs at once.
+const transitionBatchConcurrency = 5
+
+//Moves many issues through the same transition, a few at a time.
+//Every key gets an entry in the returned map, nil when its transition went through.
+//The error is only set when some of the transitions failed.
+func (jc *JiraClient) DoTransitionBatch(issueKeys []string, transitionName string) (map[string]error, error) {
+	results := map[string]error{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, transitionBatchConcurrency)
+	for _, k := range issueKeys {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			err := jc.DoTransition(key, transitionName, nil)
+			<-sem
+			mu.Lock()
+			results[key] = err
+			mu.Unlock()
+		}(k)
+	}
+	wg.Wait()
+	failed := 0
+	for _, err := range results {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return results, &JiraClientError{fmt.Sprintf("%d of %d transitions failed", failed, len(results))}
+	}
+	return results, nil
+}
+
 type IssueError struct {
 	message string
 }
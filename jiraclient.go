@@ -1,8 +1,9 @@
 package libgojira
 
 import (
-	"bufio"
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
@@ -13,9 +14,13 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/hoisie/mustache"
 	"thezombie.net/oauth1a"
@@ -31,14 +36,25 @@ type Options struct {
 	Verbose  bool     `short:"v" long:"verbose" description:"Be verbose"`
 	Projects []string `short:"j" long:"project"`
 
-	Server          string `short:"s" long:"server" description:"Jira server (just the domain name)"`
+	Server          string `short:"s" long:"server" description:"Jira server, either a domain name or a base url with scheme, port and path"`
 	IncludeSubtasks bool   `short:"a" long:"subtasks" description:"When grabbing an issue, also grab its subtasks"`
-}
-
-var options Options
 
-func SetOptions(opts Options) {
-	options = opts
+	Proxy            string            `long:"proxy" description:"Url of the http proxy to go through"`
+	EnvProxy         bool              `long:"env-proxy" description:"Use the proxy set in the HTTP_PROXY/HTTPS_PROXY environment variables"`
+	APIVersion       string            `long:"api-version" description:"Version of the Jira REST api to use" default:"2"`
+	ValidateFields   bool              `long:"validate-fields" description:"Check required fields are set before creating an issue"`
+	MetaCacheTTL     time.Duration     `long:"meta-cache-ttl" description:"How long to keep Jira metadata cached, 0 for the default of 5m, negative to disable"`
+	RenderComments   bool              `long:"render-comments" description:"Also fetch the html rendering of comments"`
+	CacheIssues      bool              `long:"cache-issues" description:"Keep fetched issues in memory and only refetch them when they changed"`
+	IssueCacheSize   int               `long:"issue-cache-size" description:"How many issues to keep cached, 0 for the default of 100"`
+	LaxIssueKeys     bool              `long:"lax-issue-keys" description:"Accept issue keys in any case, for instances with custom project key formats"`
+	RateLimit        float64           `long:"rate-limit" description:"Maximum requests per second sent to Jira, 0 for no limit"`
+	Headers          map[string]string `long:"header" description:"Extra header sent with every request, as name:value"`
+	PageSize         int               `long:"page-size" description:"How many items to ask for per page of paginated listings, 0 for the default of 50"`
+	CheckUploads     bool              `long:"check-uploads" description:"Check attachments are enabled and the file is within the size limit before uploading"`
+	DryRun           bool              `long:"dry-run" description:"Print the changes that would be sent to Jira instead of sending them"`
+	SprintField      string            `long:"sprint-field" description:"Id of the sprint custom field, found automatically when empty"`
+	StoryPointsField string            `long:"story-points-field" description:"Id of the story points custom field, found automatically when empty"`
 }
 
 //Worker object in charge of communicating with Jira, wrapper to the API
@@ -49,23 +65,162 @@ type JiraClient struct {
 	options      Options
 	OAuthCfg     *oauth1a.UserConfig
 	OAuthService *oauth1a.Service
+	meta         *metaCache
+	issues       *issueCache
+	limiter      *rateLimiter
+	accounts     *stringCache
+	fieldIds     *customFieldIds
+
+	//Called before every request and after every response, for instrumentation.
+	OnRequest  func(*http.Request)
+	OnResponse func(*http.Response, time.Duration)
+}
+
+var (
+	issueKeyRegex    = regexp.MustCompile(`^[A-Z][A-Z0-9_]*-[0-9]+$`)
+	laxIssueKeyRegex = regexp.MustCompile(`(?i)^[a-z][a-z0-9_]*-[0-9]+$`)
+	issueIdRegex     = regexp.MustCompile(`^[0-9]+$`)
+	issueRefRegex    = regexp.MustCompile(`\b[A-Z][A-Z0-9_]*-[0-9]+\b`)
+)
+
+//Tells whether key looks like an issue key, e.g. PROJECT-123.
+func ValidIssueKey(key string) bool {
+	return issueKeyRegex.MatchString(key)
+}
+
+//Finds the issue keys mentioned in text, e.g. a commit message, in order and without duplicates.
+func ExtractIssueKeys(text string) []string {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, k := range issueRefRegex.FindAllString(text, -1) {
+		if !seen[k] {
+			seen[k] = true
+			result = append(result, k)
+		}
+	}
+	return result
 }
 
-func NewJiraClient(options Options) *JiraClient {
+//Like ExtractIssueKeys, keeping only the keys of projects that exist on the instance.
+func (jc *JiraClient) ExtractKnownIssueKeys(text string) ([]string, error) {
+	projects, err := jc.GetProjList()
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, p := range projects {
+		known[p] = true
+	}
+	result := []string{}
+	for _, k := range ExtractIssueKeys(text) {
+		if known[k[:strings.LastIndex(k, "-")]] {
+			result = append(result, k)
+		}
+	}
+	return result, nil
+}
+
+//Fails fast on malformed issue keys rather than letting Jira answer with a 404.
+//Numeric issue ids are accepted as well.
+func (jc *JiraClient) checkIssueKey(key string) error {
+	if issueKeyRegex.MatchString(key) || issueIdRegex.MatchString(key) {
+		return nil
+	}
+	if jc.options.LaxIssueKeys && laxIssueKeyRegex.MatchString(key) {
+		return nil
+	}
+	return &JiraClientError{fmt.Sprintf("Bad issue key: %q", key)}
+}
+
+var defaultClient struct {
+	sync.Mutex
+	options Options
+	client  *JiraClient
+}
+
+//Sets the options of the client DefaultClient returns.
+//
+// Deprecated: options belong to each client, pass them to NewJiraClient.
+func SetOptions(opts Options) {
+	defaultClient.Lock()
+	defer defaultClient.Unlock()
+	defaultClient.options = opts
+	defaultClient.client = nil
+}
+
+//Returns a client built from the options last given to SetOptions.
+//
+// Deprecated: create clients with NewJiraClient.
+func DefaultClient() (*JiraClient, error) {
+	defaultClient.Lock()
+	defer defaultClient.Unlock()
+	if defaultClient.client == nil {
+		jc, err := NewJiraClient(defaultClient.options)
+		if err != nil {
+			return nil, err
+		}
+		defaultClient.client = jc
+	}
+	return defaultClient.client, nil
+}
+
+//Creates a client from the options, checking the server url, proxy and credentials make sense.
+func NewJiraClient(options Options) (*JiraClient, error) {
+	if options.Server == "" {
+		return nil, &JiraClientError{"No server set"}
+	}
+	u, err := url.Parse(serverUrl(options.Server))
+	if err != nil || u.Host == "" {
+		return nil, &JiraClientError{fmt.Sprintf("Bad server: %s", options.Server)}
+	}
+	options.User, options.Passwd = resolveCredentials(u.Hostname(), options.User, options.Passwd)
+	if options.User == "" && options.Passwd != "" {
+		return nil, &JiraClientError{"Password set without a user"}
+	}
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: options.NoCheckSSL},
 	}
-	//	options.Verbose = true
+	if options.Proxy != "" {
+		proxy, err := url.Parse(options.Proxy)
+		if err != nil || proxy.Scheme == "" || proxy.Host == "" {
+			return nil, &JiraClientError{fmt.Sprintf("Bad proxy url: %s", options.Proxy)}
+		}
+		tr.Proxy = http.ProxyURL(proxy)
+	} else if options.EnvProxy {
+		tr.Proxy = http.ProxyFromEnvironment
+	}
 
 	jar, err := cookiejar.New(nil)
 	if err != nil {
 		log.Println(err)
 	}
 	client := &http.Client{Transport: tr, Jar: jar}
-	return &JiraClient{client, options.User, options.Passwd, options.Server, options, nil, nil}
+	return NewJiraClientWithHTTPClient(options, client), nil
 
 }
 
+//Creates a client sending its requests through the given http client,
+//for custom transports, instrumentation or tests.
+//The options' transport settings (NoCheckSSL, Proxy) are left to the caller.
+func NewJiraClientWithHTTPClient(options Options, client *http.Client) *JiraClient {
+	jc := &JiraClient{client: client, User: options.User, Passwd: options.Passwd, Server: options.Server, options: options, meta: newMetaCache(), accounts: newStringCache(), fieldIds: &customFieldIds{}}
+	if options.CacheIssues {
+		jc.issues = newIssueCache(options.IssueCacheSize)
+	}
+	if options.RateLimit > 0 {
+		jc.limiter = newRateLimiter(options.RateLimit)
+	}
+	return jc
+}
+
+//Returns a copy of the client working on the given project.
+//The copy shares the http client and caches of the original, which is left untouched.
+func (jc *JiraClient) WithProject(key string) *JiraClient {
+	c := *jc
+	c.options.Projects = []string{key}
+	return &c
+}
+
 func (jc *JiraClient) GetClient() *http.Client {
 	return jc.client
 }
@@ -92,6 +247,7 @@ func (jc *JiraClient) Link(link *Link) error {
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode >= 400 {
 		b, _ := ioutil.ReadAll(resp.Body)
 		return fmt.Errorf(string(b))
@@ -99,24 +255,114 @@ func (jc *JiraClient) Link(link *Link) error {
 	return nil
 }
 
-func (jc *JiraClient) AddComment(issueKey string, comment string) (err error) {
-	b, err := json.Marshal(map[string]interface{}{"body": comment})
+//Adds a comment to an issue, returns the id Jira gave to the new comment.
+func (jc *JiraClient) AddComment(issueKey string, comment string) (string, error) {
+	return jc.AddCommentWithVisibility(issueKey, comment, "", "")
+}
+
+//Adds a comment only visible to a role or group.
+//visType is either "role" or "group", visValue is the role or group name.
+//Leaving visType empty makes the comment visible to everyone.
+func (jc *JiraClient) AddCommentWithVisibility(issueKey, comment, visType, visValue string) (string, error) {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return "", err
+	}
+	m := msi{"body": jc.textBody(comment)}
+	if visType != "" {
+		if visType != "role" && visType != "group" {
+			return "", &JiraClientError{"Visibility type must be either 'role' or 'group'"}
+		}
+		m["visibility"] = msi{"type": visType, "value": visValue}
+	}
+	b, err := json.Marshal(m)
 	if err != nil {
-		return err
+		return "", err
 	}
 	url := fmt.Sprintf("%s/%s/comment", jc.issueUrl(), issueKey)
 	if jc.options.Verbose {
 		fmt.Println(url)
 	}
+	if jc.dryRun("POST", url, b) {
+		return "", nil
+	}
 	r, err := jc.Post(url, "application/json", bytes.NewBuffer(b))
 
 	if err != nil {
-		return jc.printRespErr(r, err)
+		return "", err
 	}
+	defer r.Body.Close()
 	if r.StatusCode >= 400 {
-		return jc.printRespErr(r, &JiraClientError{"Oops."})
+		return "", jc.printRespErr(r, &JiraClientError{"Oops."})
 	}
-	return err
+	obj, err := JsonToInterface(r.Body)
+	if err != nil {
+		return "", err
+	}
+	idjs, _ := jsonWalker("id", obj)
+	id, ok := idjs.(string)
+	if !ok {
+		return "", &JiraClientError{"No comment id in response"}
+	}
+	return id, nil
+}
+
+//Api v3 wants rich text as Atlassian Document Format rather than plain strings.
+func (jc *JiraClient) textBody(s string) interface{} {
+	if jc.options.APIVersion == "3" {
+		return textToADF(s)
+	}
+	return s
+}
+
+//Wraps plain text in a minimal ADF document.
+//Blank lines separate paragraphs, other line breaks are kept as hard breaks.
+func textToADF(s string) map[string]interface{} {
+	paragraphs := []interface{}{}
+	for _, p := range strings.Split(strings.Replace(s, "\r\n", "\n", -1), "\n\n") {
+		content := []interface{}{}
+		for i, line := range strings.Split(p, "\n") {
+			if i > 0 {
+				content = append(content, msi{"type": "hardBreak"})
+			}
+			if line != "" {
+				content = append(content, msi{"type": "text", "text": line})
+			}
+		}
+		paragraphs = append(paragraphs, msi{"type": "paragraph", "content": content})
+	}
+	return map[string]interface{}{"type": "doc", "version": 1, "content": paragraphs}
+}
+
+//Flattens an ADF document back to plain text, the reverse of textToADF.
+//Formatting is dropped, paragraphs are separated by blank lines.
+func adfToText(obj interface{}) string {
+	node, ok := obj.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	switch node["type"] {
+	case "text":
+		text, _ := node["text"].(string)
+		return text
+	case "hardBreak":
+		return "\n"
+	case "mention", "emoji":
+		text, _ := jsonWalker("attrs/text", node)
+		s, _ := text.(string)
+		return s
+	}
+	parts := []string{}
+	content, _ := node["content"].([]interface{})
+	for _, c := range content {
+		parts = append(parts, adfToText(c))
+	}
+	switch node["type"] {
+	case "paragraph", "heading":
+		return strings.Join(parts, "")
+	case "doc":
+		return strings.Join(parts, "\n\n")
+	}
+	return strings.Join(parts, "\n")
 }
 
 var numregex *regexp.Regexp = regexp.MustCompile("[0-9]+")
@@ -130,10 +376,16 @@ func numOnly(s string) (string, error) {
 }
 
 func (jc *JiraClient) DelWorkLog(issueKey string, worklog_id string) (err error) {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return err
+	}
 	return jc.delById("worklog", issueKey, worklog_id)
 }
 
 func (jc *JiraClient) DelComment(issueKey string, comment_id string) (err error) {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return err
+	}
 	return jc.delById("comment", issueKey, comment_id)
 }
 
@@ -144,26 +396,301 @@ func (jc *JiraClient) delById(issueobject, issuekey, id string) (err error) {
 	}
 	r, err := jc.Delete(fmt.Sprintf("%s/%s/%s/%s", jc.issueUrl(), issuekey, issueobject, cid), "", nil)
 	if err != nil {
-		return jc.printRespErr(r, err)
+		return err
 	}
+	defer r.Body.Close()
 	return err
 }
 
-func (jc *JiraClient) GetComments(issueKey string) (err error) {
+//Archives an issue, hiding it without deleting it. Only available on Cloud.
+func (jc *JiraClient) ArchiveIssue(issueKey string) error {
+	return jc.archiveIssue(issueKey, "archive")
+}
+
+//Brings back an archived issue. Only available on Cloud.
+func (jc *JiraClient) RestoreIssue(issueKey string) error {
+	return jc.archiveIssue(issueKey, "unarchive")
+}
+
+func (jc *JiraClient) archiveIssue(issueKey, action string) error {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return err
+	}
+	si, err := jc.GetServerInfo()
+	if err != nil {
+		return err
+	}
+	if !si.IsCloud() {
+		return &JiraClientError{fmt.Sprintf("Archiving issues is not supported on %s deployments", si.DeploymentType)}
+	}
+	b, err := json.Marshal(msi{"issueIdsOrKeys": []string{issueKey}})
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf("%s/%s", jc.issueUrl(), action)
+	if jc.dryRun("PUT", u, b) {
+		return nil
+	}
+	resp, err := jc.Put(u, "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return newApiError(resp, fmt.Sprintf("Could not %s issue", action))
+	}
+	obj, err := JsonToInterface(resp.Body)
+	if err != nil {
+		return err
+	}
+	//Jira answers 200 even when the issue was refused, with the reasons in errors.
+	updatedjs, _ := jsonWalker("numberOfIssuesUpdated", obj)
+	if updated, _ := updatedjs.(float64); updated > 0 {
+		return nil
+	}
+	reasons := []string{}
+	errorsjs, _ := jsonWalker("errors", obj)
+	if errs, ok := errorsjs.(map[string]interface{}); ok {
+		for _, e := range errs {
+			msgjs, _ := jsonWalker("message", e)
+			if msg, ok := msgjs.(string); ok {
+				reasons = append(reasons, msg)
+			}
+		}
+	}
+	return &JiraClientError{fmt.Sprintf("Could not %s %s: %s", action, issueKey, strings.Join(reasons, ", "))}
+}
+
+//Deletes an issue. If the issue has subtasks, deleteSubtasks must be set
+//or Jira will refuse with a 400.
+func (jc *JiraClient) DeleteIssue(issueKey string, deleteSubtasks bool) error {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return err
+	}
+	u := fmt.Sprintf("%s/%s?deleteSubtasks=%t", jc.issueUrl(), issueKey, deleteSubtasks)
+	if jc.dryRun("DELETE", u, nil) {
+		return nil
+	}
+	r, err := jc.Delete(u, "", nil)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	switch r.StatusCode {
+	case 204:
+		return nil
+	case 400:
+		return newApiError(r, "Issue has subtasks, set deleteSubtasks to delete them")
+	case 403:
+		return newApiError(r, "Unauthorized")
+	case 404:
+		return newApiError(r, "Not found")
+	}
+	return newApiError(r, "Could not delete issue")
+}
+
+func (jc *JiraClient) GetComment(issueKey, commentID string) (*Comment, error) {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return nil, err
+	}
+	cid, err := numOnly(commentID)
+	if err != nil {
+		return nil, &JiraClientError{"Bad comment id"}
+	}
+	u := fmt.Sprintf("%s/%s/comment/%s", jc.issueUrl(), issueKey, cid)
+	if jc.options.RenderComments {
+		u += "?expand=renderedBody"
+	}
+	r, err := jc.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode == 404 {
+		return nil, newApiError(r, "Comment not found")
+	}
+	if r.StatusCode >= 400 {
+		return nil, newApiError(r, "Could not get comment")
+	}
+	obj, err := JsonToInterface(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	cm := commentFromIFace(obj)
+	if cm == nil {
+		return nil, &JiraClientError{"Bad comment"}
+	}
+	return cm, nil
+}
+
+//Votes for an issue as the current user.
+func (jc *JiraClient) Vote(issueKey string) error {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return err
+	}
+	r, err := jc.Post(fmt.Sprintf("%s/%s/votes", jc.issueUrl(), issueKey), "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	return votesErr(r)
+}
+
+//Removes the current user's vote from an issue.
+func (jc *JiraClient) Unvote(issueKey string) error {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return err
+	}
+	r, err := jc.Delete(fmt.Sprintf("%s/%s/votes", jc.issueUrl(), issueKey), "", nil)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	return votesErr(r)
+}
+
+func votesErr(r *http.Response) error {
+	switch {
+	case r.StatusCode < 300:
+		return nil
+	case r.StatusCode == 400:
+		return newApiError(r, "Cannot vote on this issue, voting may be disabled or you reported it")
+	case r.StatusCode == 404:
+		return newApiError(r, "Not found")
+	}
+	return newApiError(r, "Vote failed")
+}
+
+//Returns the number of votes on an issue and the names of the voters.
+//The voters list is empty if the user isn't allowed to view it.
+func (jc *JiraClient) GetVotes(issueKey string) (int, []string, error) {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return 0, nil, err
+	}
+	r, err := jc.Get(fmt.Sprintf("%s/%s/votes", jc.issueUrl(), issueKey))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode >= 300 {
+		return 0, nil, newApiError(r, "Could not get votes")
+	}
+	obj, err := JsonToInterface(r.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	votesjs, _ := jsonWalker("votes", obj)
+	votes, _ := votesjs.(float64)
+	votersjs, _ := jsonWalker("voters", obj)
+	voters := []string{}
+	if vs, ok := votersjs.([]interface{}); ok {
+		for _, v := range vs {
+			namejs, _ := jsonWalker("name", v)
+			if name, ok := namejs.(string); ok {
+				voters = append(voters, name)
+				continue
+			}
+			accountjs, _ := jsonWalker("accountId", v)
+			if account, ok := accountjs.(string); ok {
+				voters = append(voters, account)
+			}
+		}
+	}
+	return int(votes), voters, nil
+}
+
+//Counts the watchers of an issue without fetching them.
+func (jc *JiraClient) GetWatcherCount(issueKey string) (int, error) {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return 0, err
+	}
+	obj, err := jc.getJson(fmt.Sprintf("%s/%s?fields=watches", jc.issueUrl(), issueKey))
+	if err != nil {
+		return 0, err
+	}
+	countjs, _ := jsonWalker("fields/watches/watchCount", obj)
+	count, _ := countjs.(float64)
+	return int(count), nil
+}
+
+//Narrows down the comments returned by GetCommentsFiltered.
+type CommentFilter struct {
+	Since  time.Time //Only comments made at or after this time
+	Author string    //Only comments by this author, by display name or account id/user name
+}
+
+//Fetches the comments of an issue matching the filter, oldest first.
+//Jira can't filter comments, so every page is still fetched and filtered here.
+func (jc *JiraClient) GetCommentsFiltered(issueKey string, filter CommentFilter) (CommentList, error) {
+	comments, err := jc.GetComments(issueKey)
+	if err != nil {
+		return nil, err
+	}
+	result := CommentList{}
+	for _, cm := range comments {
+		if !filter.Since.IsZero() && cm.Created.Before(filter.Since) {
+			continue
+		}
+		if filter.Author != "" && cm.AuthorName != filter.Author && cm.AuthorId != filter.Author {
+			continue
+		}
+		result = append(result, cm)
+	}
+	return result, nil
+}
+
+//Fetches all the comments of an issue, oldest first.
+func (jc *JiraClient) GetComments(issueKey string) (CommentList, error) {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("%s/%s/comment?orderBy=created", jc.issueUrl(), issueKey)
+	if jc.options.RenderComments {
+		u += "&expand=renderedBody"
+	}
+	comments, err := jc.fetchAllPages(u, "comments")
+	if err != nil {
+		return nil, err
+	}
+	return commentsFromIFace(comments), nil
+}
 
-	return &JiraClientError{"Not implemented"}
+//Fetches a page of comments, along with the total number of comments on the issue.
+//orderBy is "created" for oldest first, "-created" for newest first, or empty for Jira's default.
+func (jc *JiraClient) GetCommentsPage(issueKey string, startAt, maxResults int, orderBy string) (CommentList, int, error) {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return nil, 0, err
+	}
+	u := fmt.Sprintf("%s/%s/comment?startAt=%d&maxResults=%d", jc.issueUrl(), issueKey, startAt, maxResults)
+	if orderBy != "" {
+		u += "&orderBy=" + url.QueryEscape(orderBy)
+	}
+	if jc.options.RenderComments {
+		u += "&expand=renderedBody"
+	}
+	obj, err := jc.getJson(u)
+	if err != nil {
+		return nil, 0, err
+	}
+	commentsjs, _ := jsonWalker("comments", obj)
+	totaljs, _ := jsonWalker("total", obj)
+	total, _ := totaljs.(float64)
+	return commentsFromIFace(commentsjs), int(total), nil
 }
 
 func (jc *JiraClient) printRespErr(res *http.Response, err error) error {
 	if jc.options.Verbose {
 		fmt.Println("Status code: ", res.StatusCode)
+		s, _ := ioutil.ReadAll(res.Body)
+		fmt.Println(string(s))
 	}
-	s, _ := ioutil.ReadAll(res.Body)
-	fmt.Println(string(s))
 	return err
 }
 
 func (jc *JiraClient) DelAttachment(issueKey string, att_name string) (err error) {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return err
+	}
 	iss, err := jc.GetIssue(issueKey)
 	if err != nil {
 		return err
@@ -171,46 +698,117 @@ func (jc *JiraClient) DelAttachment(issueKey string, att_name string) (err error
 
 	for _, att := range iss.Files {
 		if att.name == att_name {
-			res, err := jc.Delete(att.self, "", nil)
-			if res.StatusCode == 404 {
-				return &JiraClientError{"Not found"}
-			}
-			if res.StatusCode == 403 {
-				return &JiraClientError{"Unauthorized"}
-			}
-			if jc.options.Verbose {
-				fmt.Println(res.StatusCode)
-				sb, _ := ioutil.ReadAll(res.Body)
-				fmt.Println(string(sb))
-			}
-
-			if err != nil {
-				return err
-			}
-			log.Println("File removed from issue!")
-			return nil
+			return jc.delAttachment(att)
 		}
 	}
 	return &JiraClientError{"File not found"}
 
 }
 
+func (jc *JiraClient) delAttachment(att *IssueFile) error {
+	res, err := jc.Delete(att.self, "", nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 {
+		return &JiraClientError{"Not found"}
+	}
+	if res.StatusCode == 403 {
+		return &JiraClientError{"Unauthorized"}
+	}
+	if jc.options.Verbose {
+		fmt.Println(res.StatusCode)
+		sb, _ := ioutil.ReadAll(res.Body)
+		fmt.Println(string(sb))
+		log.Println("File removed from issue!")
+	}
+	return nil
+}
+
+//Swaps an attachment for a new file and returns the new attachment.
+//The new file is uploaded before the old one is deleted, so a failed
+//upload leaves the original in place.
+func (jc *JiraClient) ReplaceAttachment(issueKey, oldName, newFilePath string) (*IssueFile, error) {
+	if jc.dryRun("REPLACE", fmt.Sprintf("%s/issue/%s/attachments", jc.apiUrl(), issueKey), []byte(oldName+" -> "+newFilePath)) {
+		return nil, nil
+	}
+	iss, err := jc.GetIssue(issueKey)
+	if err != nil {
+		return nil, err
+	}
+	var old *IssueFile
+	for _, att := range iss.Files {
+		if att.name == oldName {
+			old = att
+			break
+		}
+	}
+	if old == nil {
+		return nil, &JiraClientError{"File not found"}
+	}
+	files, err := jc.upload(issueKey, newFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, &JiraClientError{"No attachment in upload response"}
+	}
+	//The new attachment is returned even if the old one couldn't be deleted.
+	return files[0], jc.delAttachment(old)
+}
+
 func (jc *JiraClient) Upload(issueKey string, file string) (err error) {
+	_, err = jc.upload(issueKey, file)
+	if err != nil {
+		return err
+	}
+	if jc.options.Verbose {
+		fmt.Println("File uploaded!")
+	}
+	return nil
+}
+
+//Attaches a file to an issue, returning the attachments Jira created.
+func (jc *JiraClient) upload(issueKey string, file string) (IssueFileList, error) {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return nil, err
+	}
 	// Prepare a form that you will submit to that URL.
 	var b bytes.Buffer
 	w := multipart.NewWriter(&b)
 	// Add your image file
 	f, err := os.Open(file)
 	if err != nil {
-		return
+		return nil, err
 	}
+	defer f.Close()
 	fi, err := os.Lstat(file)
+	if err != nil {
+		return nil, err
+	}
+	if jc.options.CheckUploads {
+		settings, err := jc.GetAttachmentSettings()
+		if err != nil {
+			return nil, err
+		}
+		if !settings.Enabled {
+			return nil, &JiraClientError{"Attachments are disabled on this Jira instance"}
+		}
+		if settings.UploadLimit > 0 && fi.Size() > settings.UploadLimit {
+			return nil, &JiraClientError{fmt.Sprintf("%s is %d bytes, over Jira's upload limit of %d bytes", fi.Name(), fi.Size(), settings.UploadLimit)}
+		}
+	}
+	u := fmt.Sprintf("%s/issue/%s/attachments", jc.apiUrl(), issueKey)
+	if jc.dryRun("POST", u, []byte(file)) {
+		return IssueFileList{}, nil
+	}
 	fw, err := w.CreateFormFile("file", fi.Name())
 	if err != nil {
-		return
+		return nil, err
 	}
 	if _, err = io.Copy(fw, f); err != nil {
-		return
+		return nil, err
 	}
 	// Don't forget to close the multipart writer.
 	// If you don't close it, your request will be missing the terminating boundary.
@@ -218,28 +816,60 @@ func (jc *JiraClient) Upload(issueKey string, file string) (err error) {
 
 	// Now that you have a form, you can submit it to your handler.
 
-	res, err := jc.Post(fmt.Sprintf("https://%s/rest/api/2/issue/%s/attachments", jc.Server, issueKey), w.FormDataContentType(), &b)
+	res, err := jc.Post(u, w.FormDataContentType(), &b)
 
 	if err != nil {
-		s, _ := ioutil.ReadAll(res.Body)
-		fmt.Println(string(s))
-		return err
+		return nil, err
 	}
-	fmt.Println("File uploaded!")
-	return nil
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return nil, newApiError(res, "Could not upload file")
+	}
+	obj, err := JsonToInterface(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	files := IssueFileList{}
+	if atts, ok := obj.([]interface{}); ok {
+		for _, v := range atts {
+			if f := issueFileFromIface(v); f != nil {
+				files = append(files, f)
+			}
+		}
+	}
+	return files, nil
 }
 
 //Represents search options to Jira
 type SearchOptions struct {
 	Projects      []string //Limit search to a specific project
 	CurrentSprint bool     //Limit search to stories in current sprint
-	Open          bool     //Limit search to open issues
+	BoardID       int      //With CurrentSprint, only look at the board's project. ANDed with Projects if both are set.
+	Open          bool     //Limit search to open (unresolved) issues
+	OpenStatus    bool     //Make Open look for the literal "open" status instead, like it used to
+	Unresolved    bool     //Limit search to unresolved issues whatever their status. ANDed with Status if both are set.
 	Issue         string   //Limit search to a single issue
 	JQL           string   //Pure JQL query, has precedence over any other option
+	OrderBy       string   //Field to sort on. Defaults to rank with CurrentSprint or BoardID, unsorted otherwise. Ignored with JQL.
+	OrderDesc     bool     //Sort in descending order
 	Type          []string
 	NotType       []string
 	Status        []string
 	NotStatus     []string
+	Assignee      string    //Limit search to issues assigned to this user
+	Reporter      string    //Limit search to issues reported by this user
+	Mine          bool      //Limit search to issues assigned to the current user
+	CreatedAfter  time.Time //Limit search to issues created on or after this day
+	CreatedBefore time.Time //Limit search to issues created before this day
+	UpdatedAfter  time.Time //Limit search to issues updated on or after this day
+	UpdatedBefore time.Time //Limit search to issues updated before this day
+}
+
+//Quotes a value for the JQL built by Search, escaping quotes and url special characters.
+func jqlQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `'`, `\'`, -1)
+	return url.QueryEscape("'" + s + "'")
 }
 
 func (ja *JiraClient) Search(searchoptions *SearchOptions) ([]*Issue, error) {
@@ -248,16 +878,33 @@ func (ja *JiraClient) Search(searchoptions *SearchOptions) ([]*Issue, error) {
 		jql := make([]string, 0)
 		if searchoptions.CurrentSprint {
 			jql = append(jql, "sprint+in+openSprints()")
+			//openSprints() matches the open sprints of every board, narrow it down.
+			if searchoptions.BoardID != 0 {
+				board, err := ja.GetBoard(searchoptions.BoardID)
+				if err != nil {
+					return nil, err
+				}
+				if board.ProjectKey == "" {
+					return nil, &JiraClientError{fmt.Sprintf("Board %d isn't attached to a project", board.Id)}
+				}
+				jql = append(jql, fmt.Sprintf("project+=+'%s'", board.ProjectKey))
+			}
 		}
 		if searchoptions.Open {
-			jql = append(jql, "status+=+'open'")
+			if searchoptions.OpenStatus {
+				jql = append(jql, "status+=+'open'")
+			} else {
+				jql = append(jql, "resolution+=+Unresolved")
+			}
+		}
+		if searchoptions.Unresolved && !(searchoptions.Open && !searchoptions.OpenStatus) {
+			jql = append(jql, "resolution+=+Unresolved")
 		}
 		if searchoptions.Issue != "" {
 			searchoptions.Issue = strings.Replace(searchoptions.Issue, " ", "+", -1)
 			jql = append(jql, fmt.Sprintf("issue+=+'%s'+or+parent+=+'%s'", searchoptions.Issue, searchoptions.Issue))
 		}
 		if len(searchoptions.Projects) > 0 {
-			searchoptions.Projects = searchoptions.Projects //strings.Replace(strings.searchoptions.Project, " ", "+", -1)
 			jql = append(jql, fmt.Sprintf("project+in+('%s')", strings.Replace(strings.Join(searchoptions.Projects, "','"), " ", "+", -1)))
 		}
 		if len(searchoptions.Type) > 0 {
@@ -272,68 +919,189 @@ func (ja *JiraClient) Search(searchoptions *SearchOptions) ([]*Issue, error) {
 		if len(searchoptions.NotStatus) > 0 {
 			jql = append(jql, strings.Replace(fmt.Sprintf("status+not+in+('%s')", strings.Join(searchoptions.NotStatus, "','")), " ", "+", -1))
 		}
+		if searchoptions.Assignee != "" {
+			jql = append(jql, "assignee+=+"+jqlQuote(searchoptions.Assignee))
+		}
+		if searchoptions.Reporter != "" {
+			jql = append(jql, "reporter+=+"+jqlQuote(searchoptions.Reporter))
+		}
+		if searchoptions.Mine {
+			jql = append(jql, "assignee+=+currentUser()")
+		}
+		for _, r := range []struct {
+			field         string
+			after, before time.Time
+		}{
+			{"created", searchoptions.CreatedAfter, searchoptions.CreatedBefore},
+			{"updated", searchoptions.UpdatedAfter, searchoptions.UpdatedBefore},
+		} {
+			if !r.after.IsZero() && !r.before.IsZero() && !r.after.Before(r.before) {
+				return nil, &JiraClientError{fmt.Sprintf("Bad %s range, %[2]sAfter must be before %[2]sBefore", r.field, capitalize(r.field))}
+			}
+			if !r.after.IsZero() {
+				jql = append(jql, fmt.Sprintf("%s+>=+%s", r.field, jqlQuote(r.after.Format(JIRA_DATE_FORMAT))))
+			}
+			if !r.before.IsZero() {
+				jql = append(jql, fmt.Sprintf("%s+<+%s", r.field, jqlQuote(r.before.Format(JIRA_DATE_FORMAT))))
+			}
+		}
 
-		jqlstr = strings.Join(jql, "+AND+") + "+order+by+rank"
+		jqlstr = strings.Join(jql, "+AND+")
+		orderby := searchoptions.OrderBy
+		if orderby == "" && (searchoptions.CurrentSprint || searchoptions.BoardID != 0) {
+			orderby = "rank"
+		}
+		if orderby != "" {
+			jqlstr += "+order+by+" + strings.Replace(orderby, " ", "+", -1)
+			if searchoptions.OrderDesc {
+				jqlstr += "+DESC"
+			}
+		}
 	} else {
 		jqlstr = strings.Replace(searchoptions.JQL, " ", "+", -1)
 	}
-	url := fmt.Sprintf("https://%s/rest/api/2/search?jql=%s&fields=*all", ja.Server, jqlstr)
+	url := fmt.Sprintf("%s/search?jql=%s&fields=*all", ja.apiUrl(), jqlstr)
 	if ja.options.Verbose {
 		fmt.Println(url)
 	}
-	i := 0
+	issues, err := ja.fetchAllPages(url, "issues")
+	if err != nil {
+		return nil, err
+	}
+	return ja.issuesFromIface(issues), nil
+}
+
+//Parses the issues of a listing, skipping the ones that can't be.
+//The custom field ids are resolved once for the whole listing.
+func (jc *JiraClient) issuesFromIface(objs []interface{}) []*Issue {
 	result := []*Issue{}
-	for {
-		if options.Verbose {
-			fmt.Println(url + fmt.Sprintf("&startAt=%d", i))
-		}
-		resp, err := ja.Get(url + fmt.Sprintf("&startAt=%d", i))
+	if len(objs) == 0 {
+		return result
+	}
+	ids := jc.issueFieldIds()
+	for _, v := range objs {
+		iss, err := jc.newIssueFromIface(v, ids)
 		if err != nil {
-			if resp != nil {
-				fmt.Println(resp.StatusCode)
-				b, _ := ioutil.ReadAll(resp.Body)
-				fmt.Println(string(b))
+			if jc.options.Verbose {
+				fmt.Println(err)
 			}
-			return nil, err
+			continue
 		}
-		if resp.StatusCode >= 300 {
-			fmt.Println(resp.StatusCode)
-			b, _ := ioutil.ReadAll(resp.Body)
-			fmt.Println(string(b))
+		result = append(result, iss)
+	}
+	return result
+}
 
-			return nil, &JiraClientError{resp.Status}
-		}
+//Keys per search in GetIssues, keeping the query well under url length limits.
+const issuesPerSearch = 100
 
-		obj, err := JsonToInterface(resp.Body)
+//Fetches several issues with as few searches as possible, in the order of keys.
+//Keys of issues that don't exist are skipped.
+func (jc *JiraClient) GetIssues(keys []string) ([]*Issue, error) {
+	for _, k := range keys {
+		if err := jc.checkIssueKey(k); err != nil {
+			return nil, err
+		}
+	}
+	found := map[string]*Issue{}
+	for start := 0; start < len(keys); start += issuesPerSearch {
+		end := start + issuesPerSearch
+		if end > len(keys) {
+			end = len(keys)
+		}
+		jql := fmt.Sprintf("issue in (%s)", strings.Join(keys[start:end], ","))
+		//validateQuery=warn makes Jira ignore unknown keys rather than fail the search.
+		objs, err := jc.fetchAllPages(fmt.Sprintf("%s/search?jql=%s&validateQuery=warn&fields=*all", jc.apiUrl(), url.QueryEscape(jql)), "issues")
 		if err != nil {
 			return nil, err
 		}
-		issues, _ := jsonWalker("issues", obj)
-		issuesSlice, ok := issues.([]interface{})
-
-		if !ok {
-			issuesSlice = []interface{}{}
+		for _, iss := range jc.issuesFromIface(objs) {
+			found[iss.Key] = iss
 		}
+	}
+	result := []*Issue{}
+	for _, k := range keys {
+		if iss, ok := found[strings.ToUpper(k)]; ok {
+			result = append(result, iss)
+		}
+	}
+	return result, nil
+}
 
-		for _, v := range issuesSlice {
-			iss, err := ja.NewIssueFromIface(v)
-			if err == nil {
-				result = append(result, iss)
-			}
-			if err != nil {
-				fmt.Println(err)
-			}
+//Returns how many issues match a JQL query, without fetching the issues themselves.
+func (jc *JiraClient) CountIssues(jql string) (int, error) {
+	resp, err := jc.Get(fmt.Sprintf("%s/search?jql=%s&maxResults=0", jc.apiUrl(), url.QueryEscape(jql)))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return 0, newApiError(resp, "Search failed")
+	}
+	obj, err := JsonToInterface(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	totaljs, _ := jsonWalker("total", obj)
+	total, ok := totaljs.(float64)
+	if !ok {
+		return 0, &JiraClientError{"No total in search response"}
+	}
+	return int(total), nil
+}
 
+//Counts the issues matching jql for each value of groupByField, e.g. "status" or "assignee".
+//Issues without a value are counted under "", and multi-valued fields like labels count
+//the issue once per value. Only the grouped field is fetched, but every matching issue
+//still is, a page at a time; use CountIssues with one query per value when the values
+//are known and the result set is large.
+func (jc *JiraClient) FacetCounts(jql, groupByField string) (map[string]int, error) {
+	u := fmt.Sprintf("%s/search?jql=%s&fields=%s", jc.apiUrl(), url.QueryEscape(jql), url.QueryEscape(groupByField))
+	issues, err := jc.fetchAllPages(u, "issues")
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]int{}
+	for _, iss := range issues {
+		fieldjs, _ := jsonWalker("fields/"+groupByField, iss)
+		values, ok := fieldjs.([]interface{})
+		if !ok {
+			values = []interface{}{fieldjs}
 		}
-		i = len(result)
-		if i >= (int(obj.(map[string]interface{})["total"].(float64)) - 1) {
-			break
+		if len(values) == 0 {
+			values = []interface{}{nil}
+		}
+		for _, v := range values {
+			result[facetValue(v)]++
 		}
 	}
 	return result, nil
 }
 
+//Names a field value for FacetCounts.
+func facetValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case map[string]interface{}:
+		for _, k := range []string{"name", "value", "displayName", "key", "id"} {
+			if s, ok := val[k].(string); ok {
+				return s
+			}
+		}
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+//Parses an issue as Jira sends it. Reading the sprint and story points may
+//need the field list, fetched once per client.
 func (jc *JiraClient) NewIssueFromIface(obj interface{}) (*Issue, error) {
+	return jc.newIssueFromIface(obj, jc.issueFieldIds())
+}
+
+func (jc *JiraClient) newIssueFromIface(obj interface{}, ids issueFieldIds) (*Issue, error) {
 	issue := new(Issue)
 	key, err := jsonWalker("key", obj)
 	if err != nil {
@@ -350,16 +1118,17 @@ func (jc *JiraClient) NewIssueFromIface(obj interface{}) (*Issue, error) {
 
 	//Is optional
 	parentJS, _ := jsonWalker("fields/parent/key", obj)
-	var parent string
-	parent, _ = parentJS.(string)
-	if err != nil {
-		parent = ""
-	}
+	parent, _ := parentJS.(string)
 
-	//Following three things are optional
+	//Following things are optional
 	descriptionjs, _ := jsonWalker("fields/description", obj)
 	statusjs, _ := jsonWalker("fields/status/name", obj)
 	assigneejs, _ := jsonWalker("fields/assignee/name", obj)
+	reporterjs, _ := jsonWalker("fields/reporter/name", obj)
+	if reporterjs == nil {
+		//Cloud has no user names
+		reporterjs, _ = jsonWalker("fields/reporter/displayName", obj)
+	}
 
 	ok, ok2, ok3 := true, true, true
 	issue.Key, ok = key.(string)
@@ -369,8 +1138,28 @@ func (jc *JiraClient) NewIssueFromIface(obj interface{}) (*Issue, error) {
 	issue.Description, _ = descriptionjs.(string)
 	issue.Status, _ = statusjs.(string)
 	issue.Assignee, _ = assigneejs.(string)
+	issue.Reporter, _ = reporterjs.(string)
+	issue.Created = parseJiraTime("fields/created", obj)
+	issue.Updated = parseJiraTime("fields/updated", obj)
+	duejs, _ := jsonWalker("fields/duedate", obj)
+	if due, ok := duejs.(string); ok {
+		if d, err := time.Parse(JIRA_DATE_FORMAT, due); err == nil {
+			issue.DueDate = &d
+		}
+	}
 	issue.Files = getFileListFromIface(obj)
+	fieldsjs, _ := jsonWalker("fields", obj)
+	issue.raw, _ = fieldsjs.(map[string]interface{})
 	issue.Points, _ = grabCustomField("customfield_10003", obj)
+	watchjs, _ := jsonWalker("fields/watches/watchCount", obj)
+	watchCount, _ := watchjs.(float64)
+	issue.WatchCount = int(watchCount)
+	if ids.sprint != "" {
+		issue.Sprint = sprintFromField(issue.raw[ids.sprint])
+	}
+	if ids.storyPoints != "" {
+		issue.StoryPoints, _ = issue.raw[ids.storyPoints].(float64)
+	}
 	if !(ok && ok2 && ok3) {
 		return nil, newIssueError("Bad Issue")
 	}
@@ -423,15 +1212,20 @@ func (jc *JiraClient) NewIssueFromIface(obj interface{}) (*Issue, error) {
 		issue.RemainingEstimate, _ = RemainingEstimateJs.(float64)
 		issue.TimeSpent, _ = TimeSpentJs.(float64)
 	}
-	issue.TimeLog = TimeLogForIssue(issue, obj)
+	if worklogs := jc.fetchAllWorklogs(issue.Key, obj); worklogs != nil {
+		issue.TimeLog = TimeLogForIssue(issue, map[string]interface{}{
+			"fields": map[string]interface{}{"worklog": map[string]interface{}{"worklogs": worklogs}}})
+	} else {
+		issue.TimeLog = TimeLogForIssue(issue, obj)
+	}
 	comms, err := jsonWalker("fields/comment/comments", obj)
 	if err == nil {
 		issue.Comments = commentsFromIFace(comms)
-		if options.Verbose {
+		if jc.options.Verbose {
 			fmt.Println(issue.Comments)
 		}
 	} else {
-		if options.Verbose {
+		if jc.options.Verbose {
 			fmt.Println(err)
 
 		}
@@ -442,6 +1236,38 @@ func (jc *JiraClient) NewIssueFromIface(obj interface{}) (*Issue, error) {
 	return issue, nil
 }
 
+//Issues only embed their first 20 worklogs, pages through all of them when
+//there are more. Returns nil when the embedded ones are complete, or when
+//they couldn't be fetched, in which case the embedded ones have to do.
+func (jc *JiraClient) fetchAllWorklogs(issueKey string, obj interface{}) []interface{} {
+	totaljs, _ := jsonWalker("fields/worklog/total", obj)
+	total, _ := totaljs.(float64)
+	logsjs, _ := jsonWalker("fields/worklog/worklogs", obj)
+	logs, _ := logsjs.([]interface{})
+	if int(total) <= len(logs) {
+		return nil
+	}
+	logs, err := jc.fetchAllPages(fmt.Sprintf("%s/%s/worklog", jc.issueUrl(), issueKey), "worklogs")
+	if err != nil {
+		if jc.options.Verbose {
+			fmt.Println(err)
+		}
+		return nil
+	}
+	return logs
+}
+
+//Reads a timestamp at path, zero if it's missing or malformed.
+func parseJiraTime(path string, obj interface{}) time.Time {
+	tjs, _ := jsonWalker(path, obj)
+	ts, ok := tjs.(string)
+	if !ok {
+		return time.Time{}
+	}
+	t, _ := time.Parse(JIRA_TIME_FORMAT, ts)
+	return t
+}
+
 func grabCustomField(fieldname string, obj interface{}) (string, error) {
 	ifields, err := jsonWalker("fields", obj)
 	if err != nil {
@@ -460,21 +1286,114 @@ func commentsFromIFace(obj interface{}) CommentList {
 	result := CommentList{}
 	if comments, ok := obj.([]interface{}); ok {
 		for _, cmj := range comments {
-			if cm, ok := cmj.(map[string]interface{}); ok {
-				if id, ok2 := cm["id"].(string); ok2 {
-					if body, ok3 := cm["body"].(string); ok3 {
-						if author, ok := cm["author"].(map[string]interface{})["displayName"].(string); ok {
-							result = append(result, &Comment{Id: id, Body: body, AuthorName: author})
-						}
-					}
-
-				}
+			if cm := commentFromIFace(cmj); cm != nil {
+				result = append(result, cm)
 			}
 		}
 	}
 	return result
 }
 
+func commentFromIFace(obj interface{}) *Comment {
+	if cm, ok := obj.(map[string]interface{}); ok {
+		if id, ok2 := cm["id"].(string); ok2 {
+			var body string
+			switch b := cm["body"].(type) {
+			case string:
+				body = b
+			case map[string]interface{}:
+				//Api v3 sends ADF documents
+				body = adfToText(b)
+			default:
+				return nil
+			}
+			//The author is missing on anonymous comments
+			authorjs, _ := jsonWalker("author/displayName", cm)
+			author, _ := authorjs.(string)
+			rendered, _ := cm["renderedBody"].(string)
+			//accountId on Cloud, name on Server
+			authoridjs, _ := jsonWalker("author/accountId", cm)
+			if authoridjs == nil {
+				authoridjs, _ = jsonWalker("author/name", cm)
+			}
+			authorid, _ := authoridjs.(string)
+			created := parseJiraTime("created", cm)
+			return &Comment{Id: id, Body: body, RenderedBody: rendered, AuthorName: author, AuthorId: authorid, Created: created}
+		}
+	}
+	return nil
+}
+
+func issueFileFromIface(obj interface{}) *IssueFile {
+	filename, _ := jsonWalker("filename", obj)
+	file, _ := jsonWalker("content", obj)
+	self_js, _ := jsonWalker("self", obj)
+	filenamestr, ok := filename.(string)
+	filestring, ok2 := file.(string)
+	self, ok3 := self_js.(string)
+	if !(ok && ok2 && ok3) {
+		return nil
+	}
+	f := &IssueFile{name: filenamestr, url: filestring, self: self}
+	idjs, _ := jsonWalker("id", obj)
+	sizejs, _ := jsonWalker("size", obj)
+	mimejs, _ := jsonWalker("mimeType", obj)
+	authorjs, _ := jsonWalker("author/displayName", obj)
+	thumbjs, _ := jsonWalker("thumbnail", obj)
+	switch id := idjs.(type) {
+	case string:
+		f.Id = id
+	case float64:
+		f.Id = fmt.Sprintf("%d", int64(id))
+	}
+	size, _ := sizejs.(float64)
+	f.Size = int64(size)
+	f.MimeType, _ = mimejs.(string)
+	f.Author, _ = authorjs.(string)
+	f.Created = parseJiraTime("created", obj)
+	f.Thumbnail, _ = thumbjs.(string)
+	return f
+}
+
+//Fetches the details of an attachment without downloading it.
+func (jc *JiraClient) GetAttachmentMeta(attachmentID string) (*IssueFile, error) {
+	id, err := numOnly(attachmentID)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := jc.getJson(fmt.Sprintf("%s/attachment/%s", jc.apiUrl(), id))
+	if err != nil {
+		return nil, err
+	}
+	f := issueFileFromIface(obj)
+	if f == nil {
+		return nil, &JiraClientError{"Bad attachment"}
+	}
+	return f, nil
+}
+
+//Attachment configuration of the instance
+type AttachmentSettings struct {
+	Enabled     bool
+	UploadLimit int64 //Largest file accepted, in bytes
+}
+
+//Tells whether attachments are enabled and how large they can be.
+//GetAttachmentMeta is taken by the per-attachment details, hence the name.
+func (jc *JiraClient) GetAttachmentSettings() (*AttachmentSettings, error) {
+	obj, err := jc.cachedGet(fmt.Sprintf("%s/attachment/meta", jc.apiUrl()))
+	if err != nil {
+		return nil, err
+	}
+	enabledjs, _ := jsonWalker("enabled", obj)
+	limitjs, _ := jsonWalker("uploadLimit", obj)
+	settings := &AttachmentSettings{}
+	settings.Enabled, _ = enabledjs.(bool)
+	limit, _ := limitjs.(float64)
+	settings.UploadLimit = int64(limit)
+	return settings, nil
+}
+
 func getFileListFromIface(obj interface{}) IssueFileList {
 	rez := make(IssueFileList, 0)
 	attachmentsjs, err := jsonWalker("fields/attachment", obj)
@@ -487,36 +1406,87 @@ func getFileListFromIface(obj interface{}) IssueFileList {
 	}
 
 	for _, v := range attachments {
-		filename, err := jsonWalker("filename", v)
-		file, err := jsonWalker("content", v)
-		self_js, err := jsonWalker("self", v)
-		if err != nil {
-			continue
-		}
-		filenamestr, ok := filename.(string)
-		filestring, ok2 := file.(string)
-		self, ok3 := self_js.(string)
-		if ok && ok2 && ok3 {
-			rez = append(rez, &IssueFile{name: filenamestr, url: filestring, self: self})
+		if f := issueFileFromIface(v); f != nil {
+			rez = append(rez, f)
 		}
 	}
 	return rez
 }
 
 func (jc *JiraClient) GetIssue(issueKey string) (*Issue, error) {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return nil, err
+	}
 
-	resp, err := jc.Get(fmt.Sprintf("https://%s/rest/api/2/issue/%s", jc.Server, issueKey))
+	req, err := jc.newRequest("GET", fmt.Sprintf("%s/issue/%s", jc.apiUrl(), issueKey), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	var cached issueCacheEntry
+	hascached := false
+	if jc.issues != nil {
+		cached, hascached = jc.issues.get(issueKey)
+		if hascached && cached.etag != "" {
+			req.Header.Add("If-None-Match", cached.etag)
+		}
+		if hascached && cached.lastModified != "" {
+			req.Header.Add("If-Modified-Since", cached.lastModified)
+		}
+	}
+	resp, err := jc.do(req)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == 304 && hascached {
+		return cached.issue, nil
+	}
+	if resp.StatusCode == 404 {
+		return nil, newApiError(resp, "Issue not found")
+	}
+	if resp.StatusCode >= 300 {
+		return nil, newApiError(resp, "Could not get issue")
 	}
 	obj, err := JsonToInterface(resp.Body)
+	if err != nil {
+		return nil, err
+	}
 	iss, err := jc.NewIssueFromIface(obj)
 	if err != nil {
 		return nil, err
 	}
+	if jc.issues != nil {
+		etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			jc.issues.set(issueKey, issueCacheEntry{iss, etag, lastModified})
+		}
+	}
 	return iss, nil
 }
 
+//Fetches an issue as untyped json, for the fields Issue doesn't carry.
+func (jc *JiraClient) GetIssueRaw(issueKey string) (map[string]interface{}, error) {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return nil, err
+	}
+	obj, err := jc.getJson(fmt.Sprintf("%s/issue/%s", jc.apiUrl(), issueKey))
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := obj.(map[string]interface{})
+	if !ok {
+		return nil, newIssueError("Bad Issue")
+	}
+	return raw, nil
+}
+
+//Drops an issue from the issue cache, so the next GetIssue refetches it.
+func (jc *JiraClient) InvalidateIssue(issueKey string) {
+	if jc.issues != nil {
+		jc.issues.remove(issueKey)
+	}
+}
+
 func tagsFromStringSlice(tags []string) []interface{} {
 	tags_obj := make([]interface{}, 0)
 	for _, tag := range tags {
@@ -532,25 +1502,85 @@ func (jc *JiraClient) AddTags(issuekey string, tags []string) error {
 
 }
 
+//Applies update operations (add, remove, set...) to an issue's fields.
 func (jc *JiraClient) UpdateIssue(issuekey string, postjs map[string]interface{}) error {
-	postdata, err := json.Marshal(map[string]interface{}{"update": postjs})
+	return jc.UpdateIssueFields(issuekey, nil, postjs)
+}
+
+//Edits an issue. fields holds values to set outright, update holds operations
+//(add, remove, set...) on fields. Either can be nil, but a field can't be in both.
+func (jc *JiraClient) UpdateIssueFields(issuekey string, fields, update map[string]interface{}) error {
+	if err := jc.checkIssueKey(issuekey); err != nil {
+		return err
+	}
+	body := map[string]interface{}{}
+	if fields != nil {
+		body["fields"] = fields
+	}
+	if update != nil {
+		body["update"] = update
+	}
+	postdata, err := json.Marshal(body)
 
 	if err != nil {
 		return err
 	}
-	resp, err := jc.Put(fmt.Sprintf("https://%s/rest/api/latest/issue/%s", jc.Server, issuekey), "application/json", bytes.NewBuffer(postdata))
+	u := fmt.Sprintf("%s/issue/%s", jc.apiUrl(), issuekey)
+	if jc.dryRun("PUT", u, postdata) {
+		return nil
+	}
+	resp, err := jc.Put(u, "application/json", bytes.NewBuffer(postdata))
 
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != 204 {
-		log.Println(resp.StatusCode)
-		return &JiraClientError{"Bad request"}
+		return newApiError(resp, "Bad request")
+	}
+	if jc.options.Verbose {
+		log.Println(fmt.Sprintf("Issue %s updated!", issuekey))
 	}
-	log.Println(fmt.Sprintf("Issue %s updated!", issuekey))
 	return nil
 }
 
+//Replaces all the labels of an issue with labels. Jira labels can't contain spaces.
+func (jc *JiraClient) SetLabels(issueKey string, labels []string) error {
+	for _, l := range labels {
+		if l == "" || strings.ContainsAny(l, " \t\n") {
+			return &JiraClientError{fmt.Sprintf("Bad label %q, labels can't be empty or contain spaces", l)}
+		}
+	}
+	if labels == nil {
+		labels = []string{}
+	}
+	return jc.UpdateIssueFields(issueKey, msi{"labels": labels}, nil)
+}
+
+//Changes the summary (title) of an issue.
+func (jc *JiraClient) SetSummary(issueKey, summary string) error {
+	return jc.UpdateIssue(issueKey, msi{"summary": []interface{}{msi{"set": summary}}})
+}
+
+//Replaces the description of an issue.
+func (jc *JiraClient) SetDescription(issueKey, description string) error {
+	return jc.UpdateIssue(issueKey, msi{"description": []interface{}{msi{"set": jc.textBody(description)}}})
+}
+
+//Sets the due date of an issue. A zero time clears it.
+func (jc *JiraClient) SetDueDate(issueKey string, due time.Time) error {
+	var value interface{}
+	if !due.IsZero() {
+		value = due.Format(JIRA_DATE_FORMAT)
+	}
+	return jc.UpdateIssue(issueKey, msi{"duedate": []interface{}{msi{"set": value}}})
+}
+
+//Removes the due date of an issue.
+func (jc *JiraClient) ClearDueDate(issueKey string) error {
+	return jc.SetDueDate(issueKey, time.Time{})
+}
+
 func (jc *JiraClient) Client() *http.Client {
 	return jc.client
 }
@@ -560,16 +1590,16 @@ func (jc *JiraClient) Get(url string) (*http.Response, error) {
 	if err != nil {
 		return nil, err
 	}
-	return jc.client.Do(req)
+	return jc.do(req)
 }
 
 func (jc *JiraClient) Post(url, mimetype string, rdr io.Reader) (*http.Response, error) {
 	req, err := jc.newRequest("POST", url, mimetype, rdr)
-	req.Header.Add("X-Atlassian-Token", "nocheck")
 	if err != nil {
 		return nil, err
 	}
-	return jc.client.Do(req)
+	req.Header.Add("X-Atlassian-Token", "nocheck")
+	return jc.do(req)
 }
 
 func (jc *JiraClient) Put(url, mimetype string, rdr io.Reader) (*http.Response, error) {
@@ -577,7 +1607,7 @@ func (jc *JiraClient) Put(url, mimetype string, rdr io.Reader) (*http.Response,
 	if err != nil {
 		return nil, err
 	}
-	return jc.client.Do(req)
+	return jc.do(req)
 }
 
 func (jc *JiraClient) Delete(url, mimetype string, rdr io.Reader) (*http.Response, error) {
@@ -585,7 +1615,137 @@ func (jc *JiraClient) Delete(url, mimetype string, rdr io.Reader) (*http.Respons
 	if err != nil {
 		return nil, err
 	}
-	return jc.client.Do(req)
+	return jc.do(req)
+}
+
+//With Options.DryRun, logs the request a mutating method would send and
+//returns true so the method returns without sending it. Methods that need a
+//meaningful result check it themselves, do() catches all the others.
+func (jc *JiraClient) dryRun(method, u string, body []byte) bool {
+	if !jc.options.DryRun {
+		return false
+	}
+	log.Printf("Dry run: %s %s\n%s", method, u, body)
+	return true
+}
+
+//Every request goes through here.
+//With Options.DryRun, anything but a read is logged and answered with an
+//empty 204 instead of being sent.
+func (jc *JiraClient) do(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" && req.Method != "HEAD" && jc.options.DryRun {
+		var body []byte
+		if req.GetBody != nil {
+			if rdr, err := req.GetBody(); err == nil {
+				body, _ = ioutil.ReadAll(rdr)
+				rdr.Close()
+			}
+		}
+		jc.dryRun(req.Method, req.URL.String(), body)
+		return &http.Response{
+			Status:     "204 No Content",
+			StatusCode: 204,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+			Request:    req,
+		}, nil
+	}
+	if jc.limiter != nil {
+		jc.limiter.wait()
+	}
+	if jc.OnRequest != nil {
+		jc.OnRequest(req)
+	}
+	start := time.Now()
+	resp, err := jc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	err = decompressBody(resp)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if jc.OnResponse != nil {
+		jc.OnResponse(resp, time.Since(start))
+	}
+	return resp, nil
+}
+
+//The transport asks for gzip and decodes it on its own, but not when the
+//Accept-Encoding header was set by hand (see Options.Headers) or a proxy
+//compressed the response anyway. This decodes whatever is left.
+func decompressBody(resp *http.Response) error {
+	var rdr io.ReadCloser
+	var err error
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "gzip":
+		rdr, err = gzip.NewReader(resp.Body)
+	case "deflate":
+		rdr, err = zlib.NewReader(resp.Body)
+	default:
+		return nil
+	}
+	if err == io.EOF {
+		//Empty body, nothing to decode.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body = &decompressedBody{rdr, resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+//Closes both the decompressor and the underlying body.
+type decompressedBody struct {
+	io.ReadCloser
+	body io.ReadCloser
+}
+
+func (db *decompressedBody) Close() error {
+	db.ReadCloser.Close()
+	return db.body.Close()
+}
+
+//Sends a request to any endpoint of the REST api and returns the parsed json response.
+//path is relative to /rest/api/{version}, e.g. "/issue/ABC-1/watchers". body is marshalled
+//to json unless nil. Returns nil if Jira answers with no content.
+func (jc *JiraClient) Do(method, path string, body interface{}) (interface{}, error) {
+	var rdr io.Reader
+	mimetype := ""
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		rdr = bytes.NewBuffer(b)
+		mimetype = "application/json"
+	}
+	req, err := jc.newRequest(method, fmt.Sprintf("%s%s", jc.apiUrl(), path), mimetype, rdr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("X-Atlassian-Token", "nocheck")
+	resp, err := jc.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, newApiError(resp, fmt.Sprintf("%s %s failed", method, path))
+	}
+	if resp.StatusCode == 204 {
+		return nil, nil
+	}
+	return JsonToInterface(resp.Body)
 }
 
 func (jc *JiraClient) newRequest(verb, url, mimetype string, rdr io.Reader) (*http.Request, error) {
@@ -593,8 +1753,15 @@ func (jc *JiraClient) newRequest(verb, url, mimetype string, rdr io.Reader) (*ht
 	if err != nil {
 		return nil, err
 	}
+	for k, v := range jc.options.Headers {
+		req.Header.Set(k, v)
+	}
 	if mimetype != "" {
-		req.Header.Add("Content-Type", mimetype)
+		req.Header.Set("Content-Type", mimetype)
+	}
+	if req.Header.Get("Authorization") != "" {
+		//An explicit Authorization header replaces the client's own auth.
+		return req, nil
 	}
 	if jc.OAuthCfg == nil {
 		req.SetBasicAuth(jc.User, jc.Passwd)
@@ -612,53 +1779,337 @@ func (jce *JiraClientError) Error() string {
 	return jce.msg
 }
 
+//Error returned when Jira answers with an error status code.
+//StatusCode tells apart the different failures (403, 404, etc.)
+type ApiError struct {
+	StatusCode    int
+	ErrorMessages []string
+	Errors        map[string]string
+	msg           string
+}
+
+func (ae *ApiError) Error() string {
+	msgs := []string{}
+	if ae.msg != "" {
+		msgs = append(msgs, ae.msg)
+	}
+	msgs = append(msgs, ae.ErrorMessages...)
+	for k, v := range ae.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", k, v))
+	}
+	return fmt.Sprintf("%d: %s", ae.StatusCode, strings.Join(msgs, ", "))
+}
+
+//Builds an ApiError from a response, picking up Jira's error messages from the body.
+func newApiError(res *http.Response, msg string) *ApiError {
+	ae := &ApiError{StatusCode: res.StatusCode, Errors: map[string]string{}, msg: msg}
+	obj, err := JsonToInterface(res.Body)
+	body, ok := obj.(map[string]interface{})
+	if err != nil || !ok {
+		return ae
+	}
+	if errmsgs, ok := body["errorMessages"].([]interface{}); ok {
+		for _, v := range errmsgs {
+			if m, ok := v.(string); ok {
+				ae.ErrorMessages = append(ae.ErrorMessages, m)
+			}
+		}
+	}
+	if errs, ok := body["errors"].(map[string]interface{}); ok {
+		for k, v := range errs {
+			ae.Errors[k] = fmt.Sprintf("%v", v)
+		}
+	}
+	return ae
+}
+
 //Helper function to read a json input and unmarshal it to an interface{} object
 func JsonToInterface(reader io.Reader) (interface{}, error) {
-	rdr := bufio.NewReader(reader)
-	js := make([]string, 0)
-	for {
-		s, err := rdr.ReadString('\n')
-		js = append(js, s)
-		if err != nil {
-			break
+	var obj interface{}
+	err := json.NewDecoder(reader).Decode(&obj)
+	//Read what's left, so http connections can be reused.
+	io.Copy(ioutil.Discard, reader)
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+//Helper function to navigate an unmarshalled json interface{} object.
+//Takes in a path in the form of "path/to/field".
+//Doesn't deal with arrays.
+func jsonWalker(path string, json interface{}) (interface{}, error) {
+	p := strings.Split(path, "/")
+	tmpval := json
+	for i, subpath := range p {
+		submap, ok := tmpval.(map[string]interface{})
+		if !ok {
+			if i == 0 {
+				return nil, errors.New("Bad json, not a map[string]interface{}")
+			}
+			return nil, errors.New(fmt.Sprintf("Bad path, %s is not a map[string]interface{}", p[i-1]))
+		}
+		if i < (len(p) - 1) {
+			tmpval = submap[subpath]
+		} else {
+			return submap[subpath], nil
+		}
+	}
+	return nil, errors.New("Woooops")
+}
+
+//Fetches the issue creation metadata, going through the client's cache.
+//Passing project keys restricts the metadata to those projects, which is much lighter.
+func (jc *JiraClient) getCreateMeta(projectKeys ...string) (interface{}, error) {
+	url := fmt.Sprintf("%s/issue/createmeta", jc.apiUrl())
+	if len(projectKeys) > 0 {
+		url += "?projectKeys=" + strings.Join(projectKeys, ",")
+	}
+	return jc.cachedGet(url)
+}
+
+//Fetches the full issue creation metadata, fields included, as parsed json.
+//Without project keys or issue type names it covers the whole instance and can be very large.
+//The result is shared with the metadata cache, don't modify it.
+func (jc *JiraClient) GetCreateMeta(projectKeys, issueTypeNames []string) (interface{}, error) {
+	params := url.Values{}
+	params.Set("expand", "projects.issuetypes.fields")
+	if len(projectKeys) > 0 {
+		params.Set("projectKeys", strings.Join(projectKeys, ","))
+	}
+	if len(issueTypeNames) > 0 {
+		params.Set("issuetypeNames", strings.Join(issueTypeNames, ","))
+	}
+	return jc.cachedGet(fmt.Sprintf("%s/issue/createmeta?%s", jc.apiUrl(), params.Encode()))
+}
+
+func (jc *JiraClient) metaTTL() time.Duration {
+	if jc.options.MetaCacheTTL == 0 {
+		return defaultMetaCacheTTL
+	}
+	return jc.options.MetaCacheTTL
+}
+
+//GETs json from url, going through the client's metadata cache.
+func (jc *JiraClient) cachedGet(url string) (interface{}, error) {
+	ttl := jc.metaTTL()
+	if obj, ok := jc.meta.get(url, ttl); ok {
+		return obj, nil
+	}
+	resp, err := jc.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, newApiError(resp, "Could not get metadata")
+	}
+	obj, err := JsonToInterface(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		jc.meta.set(url, obj)
+	}
+	return obj, nil
+}
+
+//Drops the cached issue creation metadata, so the next call refetches it.
+func (jc *JiraClient) InvalidateCreateMeta() {
+	jc.meta.clearPrefix(jc.apiUrl() + "/issue/createmeta")
+}
+
+//Drops all the cached metadata: projects, issue types, fields, statuses and server info.
+func (jc *JiraClient) RefreshMetadata() {
+	jc.meta.clear()
+	jc.fieldIds.reset()
+}
+
+//Metadata of a field on the issue creation screen
+type FieldMeta struct {
+	Id            string
+	Name          string
+	Required      bool
+	HasDefault    bool
+	Type          string
+	AllowedValues []string
+}
+
+//Lists the fields available when creating an issue of type issueType in a project.
+func (jc *JiraClient) GetCreateFields(projectKey, issueType string) ([]FieldMeta, error) {
+	obj, err := jc.cachedGet(fmt.Sprintf("%s/issue/createmeta?projectKeys=%s&expand=projects.issuetypes.fields", jc.apiUrl(), url.QueryEscape(projectKey)))
+	if err != nil {
+		return nil, err
+	}
+	projs, _ := jsonWalker("projects", obj)
+	probjs, _ := projs.([]interface{})
+	for _, p := range probjs {
+		issuesjs, _ := jsonWalker("issuetypes", p)
+		issues, _ := issuesjs.([]interface{})
+		for _, it := range issues {
+			namejs, _ := jsonWalker("name", it)
+			name, _ := namejs.(string)
+			if !strings.EqualFold(name, issueType) && strings.Replace(strings.ToLower(name), " ", "-", -1) != issueType {
+				continue
+			}
+			fieldsjs, _ := jsonWalker("fields", it)
+			fields, _ := fieldsjs.(map[string]interface{})
+			return fieldMetasFromIface(fields), nil
+		}
+	}
+	return nil, &JiraClientError{fmt.Sprintf("Issue type %s not found in project %s", issueType, projectKey)}
+}
+
+//Parses a map of field ids to field metadata, sorted by id.
+func fieldMetasFromIface(fields map[string]interface{}) []FieldMeta {
+	result := []FieldMeta{}
+	for id, f := range fields {
+		fm := FieldMeta{Id: id}
+		fnamejs, _ := jsonWalker("name", f)
+		requiredjs, _ := jsonWalker("required", f)
+		defaultjs, _ := jsonWalker("hasDefaultValue", f)
+		typejs, _ := jsonWalker("schema/type", f)
+		fm.Name, _ = fnamejs.(string)
+		fm.Required, _ = requiredjs.(bool)
+		fm.HasDefault, _ = defaultjs.(bool)
+		fm.Type, _ = typejs.(string)
+		allowedjs, _ := jsonWalker("allowedValues", f)
+		if allowed, ok := allowedjs.([]interface{}); ok {
+			for _, av := range allowed {
+				for _, k := range []string{"value", "name", "id"} {
+					vjs, _ := jsonWalker(k, av)
+					if v, ok := vjs.(string); ok {
+						fm.AllowedValues = append(fm.AllowedValues, v)
+						break
+					}
+				}
+			}
 		}
+		result = append(result, fm)
+	}
+	sort.Sort(fieldMetaById(result))
+	return result
+}
+
+type fieldMetaById []FieldMeta
+
+func (f fieldMetaById) Len() int {
+	return len(f)
+}
+
+func (f fieldMetaById) Swap(i, j int) {
+	f[i], f[j] = f[j], f[i]
+}
+
+func (f fieldMetaById) Less(i, j int) bool {
+	return f[i].Id < f[j].Id
+}
+
+//Changes the type of an issue, e.g. from bug to task. newType is a type of the
+//issue's project, by friendly or actual name. Issues can't be turned into or
+//out of subtasks this way, Jira requires moving them instead.
+func (jc *JiraClient) ChangeIssueType(issueKey, newType string) error {
+	iss, err := jc.GetIssue(issueKey)
+	if err != nil {
+		return err
+	}
+	projectjs, _ := jsonWalker("project/key", iss.raw)
+	project, _ := projectjs.(string)
+	tt, err := jc.projectTaskType(project, newType)
+	if err != nil {
+		return err
+	}
+	fromSubtaskjs, _ := jsonWalker("issuetype/subtask", iss.raw)
+	fromSubtask, _ := fromSubtaskjs.(bool)
+	toSubtask, err := jc.isSubtaskType(project, tt)
+	if err != nil {
+		return err
+	}
+	if fromSubtask != toSubtask {
+		return &JiraClientError{fmt.Sprintf("Cannot change %s from %s to %s, converting to or from a subtask requires a move", issueKey, iss.Type, tt)}
+	}
+	return jc.UpdateIssueFields(issueKey, msi{"issuetype": msi{"name": tt}}, nil)
+}
 
+//Moves an issue under another one. On Server only subtasks have a parent,
+//on Cloud any issue below the epic level can be given one.
+func (jc *JiraClient) SetParent(issueKey, parentKey string) error {
+	iss, err := jc.GetIssue(issueKey)
+	if err != nil {
+		return err
 	}
-	njs := strings.Join(js, "")
-	var obj interface{}
-	err := json.Unmarshal([]byte(njs), &obj)
+	si, err := jc.GetServerInfo()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return obj, nil
+	subtaskjs, _ := jsonWalker("issuetype/subtask", iss.raw)
+	subtask, _ := subtaskjs.(bool)
+	if !subtask && !si.IsCloud() {
+		return &JiraClientError{fmt.Sprintf("%s is a %s, which can't have a parent", issueKey, iss.Type)}
+	}
+	return jc.UpdateIssueFields(issueKey, msi{"parent": msi{"key": parentKey}}, nil)
 }
 
-//Helper function to navigate an unmarshalled json interface{} object.
-//Takes in a path in the form of "path/to/field".
-//Doesn't deal with arrays.
-func jsonWalker(path string, json interface{}) (interface{}, error) {
-	p := strings.Split(path, "/")
-	tmpval := json
-	for i, subpath := range p {
-		submap, ok := tmpval.(map[string]interface{})
-		if !ok {
-			return nil, errors.New(fmt.Sprintf("Bad path, %s is not a map[string]interface{}", p[i-1]))
-		}
-		if i < (len(p) - 1) {
-			tmpval = submap[subpath]
-		} else {
-			return submap[subpath], nil
+func (jc *JiraClient) isSubtaskType(projectKey, typeName string) (bool, error) {
+	types, err := jc.GetProjectIssueTypes(projectKey)
+	if err != nil {
+		return false, err
+	}
+	for _, t := range types {
+		if t.Name == typeName {
+			return t.Subtask, nil
 		}
 	}
-	return nil, errors.New("Woooops")
+	return false, nil
+}
+
+//An issue type as configured in a project
+type IssueType struct {
+	Id          string
+	Name        string
+	Description string
+	IconUrl     string
+	Subtask     bool
 }
 
-func (jc *JiraClient) GetTaskTypes() (map[string]map[string]string, error) {
-	resp, err := jc.Get(fmt.Sprintf("https://%s/rest/api/2/issue/createmeta", jc.Server))
+func (it *IssueType) String() string {
+	return it.Name
+}
+
+//Lists the issue types that can be created in a project, in the project's display order.
+func (jc *JiraClient) GetProjectIssueTypes(projectKey string) ([]IssueType, error) {
+	obj, err := jc.getCreateMeta(projectKey)
 	if err != nil {
 		return nil, err
 	}
-	obj, err := JsonToInterface(resp.Body)
+	result := []IssueType{}
+	projsjs, _ := jsonWalker("projects", obj)
+	projs, _ := projsjs.([]interface{})
+	for _, p := range projs {
+		typesjs, _ := jsonWalker("issuetypes", p)
+		types, _ := typesjs.([]interface{})
+		for _, t := range types {
+			idjs, _ := jsonWalker("id", t)
+			namejs, _ := jsonWalker("name", t)
+			descjs, _ := jsonWalker("description", t)
+			iconjs, _ := jsonWalker("iconUrl", t)
+			subtaskjs, _ := jsonWalker("subtask", t)
+			it := IssueType{}
+			it.Id, _ = idjs.(string)
+			it.Name, _ = namejs.(string)
+			it.Description, _ = descjs.(string)
+			it.IconUrl, _ = iconjs.(string)
+			it.Subtask, _ = subtaskjs.(bool)
+			result = append(result, it)
+		}
+	}
+	return result, nil
+}
+
+//Maps project names and keys to their task types, by friendly name.
+//Passing project keys only fetches the metadata for those projects.
+func (jc *JiraClient) GetTaskTypes(projectKeys ...string) (map[string]map[string]string, error) {
+	obj, err := jc.getCreateMeta(projectKeys...)
 	if err != nil {
 		return nil, err
 	}
@@ -703,19 +2154,82 @@ func (jc *JiraClient) GetTaskTypes() (map[string]map[string]string, error) {
 	return map[string]map[string]string{}, nil
 }
 
-func (jc *JiraClient) GetProjList() ([]string, error) {
-	resp, err := jc.Get(fmt.Sprintf("https://%s/rest/api/2/project", jc.Server))
+//An issue security level, restricting who can see an issue
+type SecurityLevel struct {
+	Id          string
+	Name        string
+	Description string
+}
+
+func (sl *SecurityLevel) String() string {
+	return fmt.Sprintf("%s: %s", sl.Id, sl.Name)
+}
+
+//Lists the security levels issues of a project can be given.
+func (jc *JiraClient) GetSecurityLevels(projectKey string) ([]SecurityLevel, error) {
+	obj, err := jc.cachedGet(fmt.Sprintf("%s/project/%s/securitylevel", jc.apiUrl(), url.PathEscape(projectKey)))
 	if err != nil {
 		return nil, err
 	}
-	obj, err := JsonToInterface(resp.Body)
+	levelsjs, _ := jsonWalker("levels", obj)
+	levels, _ := levelsjs.([]interface{})
+	result := []SecurityLevel{}
+	for _, l := range levels {
+		idjs, _ := jsonWalker("id", l)
+		namejs, _ := jsonWalker("name", l)
+		descjs, _ := jsonWalker("description", l)
+		level := SecurityLevel{}
+		level.Id, _ = idjs.(string)
+		level.Name, _ = namejs.(string)
+		level.Description, _ = descjs.(string)
+		result = append(result, level)
+	}
+	return result, nil
+}
+
+//Finds the id of a project's security level from its name or id.
+func (jc *JiraClient) securityLevelId(projectKey, level string) (string, error) {
+	levels, err := jc.GetSecurityLevels(projectKey)
+	if err != nil {
+		return "", err
+	}
+	for _, l := range levels {
+		if l.Id == level || strings.EqualFold(l.Name, level) {
+			return l.Id, nil
+		}
+	}
+	return "", &JiraClientError{fmt.Sprintf("No security level %s in project %s", level, projectKey)}
+}
+
+//Changes the security level of an issue, by name or id. An empty level removes it.
+func (jc *JiraClient) SetSecurityLevel(issueKey, level string) error {
+	if level == "" {
+		return jc.UpdateIssueFields(issueKey, msi{"security": nil}, nil)
+	}
+	iss, err := jc.GetIssue(issueKey)
+	if err != nil {
+		return err
+	}
+	projectjs, _ := jsonWalker("project/key", iss.raw)
+	project, _ := projectjs.(string)
+	id, err := jc.securityLevelId(project, level)
+	if err != nil {
+		return err
+	}
+	return jc.UpdateIssueFields(issueKey, msi{"security": msi{"id": id}}, nil)
+}
+
+//Lists the keys of all the projects. Archived projects are left out unless includeArchived is true.
+func (jc *JiraClient) GetProjList(includeArchived ...bool) ([]string, error) {
+	projs, err := jc.projectList(len(includeArchived) > 0 && includeArchived[0])
 	if err != nil {
 		return nil, err
 	}
 	result := []string{}
-	if projs, ok := obj.([]interface{}); ok {
-		for _, p := range projs {
-			result = append(result, p.(map[string]interface{})["key"].(string))
+	for _, p := range projs {
+		keyjs, _ := jsonWalker("key", p)
+		if key, ok := keyjs.(string); ok {
+			result = append(result, key)
 		}
 	}
 	if jc.options.Verbose {
@@ -724,13 +2238,63 @@ func (jc *JiraClient) GetProjList() ([]string, error) {
 	return result, nil
 }
 
-func (jc *JiraClient) GetProjects() (map[string]JiraProject, error) {
-	projmap := map[string]JiraProject{}
-	resp, err := jc.Get(fmt.Sprintf("https://%s/rest/api/2/issue/createmeta", jc.Server))
+//Lists the projects with their details, straight from the project api.
+//Cheaper than GetProjects, which goes through createmeta.
+//Archived projects are left out unless includeArchived is true.
+func (jc *JiraClient) GetProjListFull(includeArchived ...bool) ([]JiraProject, error) {
+	projs, err := jc.projectList(len(includeArchived) > 0 && includeArchived[0])
 	if err != nil {
 		return nil, err
 	}
-	obj, err := JsonToInterface(resp.Body)
+	result := []JiraProject{}
+	for _, p := range projs {
+		result = append(result, *projectFromIface(p))
+	}
+	return result, nil
+}
+
+//Fetches every project, through the metadata cache.
+//Cloud pages its project search, Server sends all the projects at once.
+func (jc *JiraClient) projectList(includeArchived bool) ([]interface{}, error) {
+	si, err := jc.GetServerInfo()
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("%s/project?expand=description,lead", jc.apiUrl())
+	if si.IsCloud() {
+		u = fmt.Sprintf("%s/project/search?expand=description,lead&status=live", jc.apiUrl())
+		if includeArchived {
+			u += "&status=archived"
+		}
+	} else if includeArchived {
+		u += "&includeArchived=true"
+	}
+	ttl := jc.metaTTL()
+	if obj, ok := jc.meta.get(u, ttl); ok {
+		return obj.([]interface{}), nil
+	}
+	var projs []interface{}
+	if si.IsCloud() {
+		projs, err = jc.fetchAllPages(u, "values")
+	} else {
+		var obj interface{}
+		obj, err = jc.getJson(u)
+		projs, _ = obj.([]interface{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		jc.meta.set(u, projs)
+	}
+	return projs, nil
+}
+
+//Maps project names and keys to projects.
+//Passing project keys only fetches the metadata for those projects.
+func (jc *JiraClient) GetProjects(projectKeys ...string) (map[string]JiraProject, error) {
+	projmap := map[string]JiraProject{}
+	obj, err := jc.getCreateMeta(projectKeys...)
 	if err != nil {
 		return nil, err
 	}
@@ -755,33 +2319,185 @@ func (jc *JiraClient) GetProjects() (map[string]JiraProject, error) {
 
 }
 
+//Fetches a single project by key or id.
+func (jc *JiraClient) GetProject(projectKeyOrID string) (*JiraProject, error) {
+	resp, err := jc.Get(fmt.Sprintf("%s/project/%s", jc.apiUrl(), url.PathEscape(projectKeyOrID)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == 404 {
+		return nil, newApiError(resp, "Project not found")
+	}
+	if resp.StatusCode >= 300 {
+		return nil, newApiError(resp, "Could not get project")
+	}
+	obj, err := JsonToInterface(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return projectFromIface(obj), nil
+}
+
+func projectFromIface(obj interface{}) *JiraProject {
+	namejs, _ := jsonWalker("name", obj)
+	keyjs, _ := jsonWalker("key", obj)
+	idjs, _ := jsonWalker("id", obj)
+	leadjs, _ := jsonWalker("lead/displayName", obj)
+	descjs, _ := jsonWalker("description", obj)
+	typejs, _ := jsonWalker("projectTypeKey", obj)
+	avatarjs, _ := jsonWalker("avatarUrls/48x48", obj)
+	proj := &JiraProject{}
+	proj.Name, _ = namejs.(string)
+	proj.Key, _ = keyjs.(string)
+	proj.Id, _ = idjs.(string)
+	proj.Lead, _ = leadjs.(string)
+	proj.Description, _ = descjs.(string)
+	proj.ProjectTypeKey, _ = typejs.(string)
+	proj.AvatarURL, _ = avatarjs.(string)
+	return proj
+}
+
 func (jc *JiraClient) GetTaskType(friendlyname string) (string, error) {
-	projmap, err := jc.GetTaskTypes()
+	if len(jc.options.Projects) == 0 {
+		return "", &JiraClientError{"No project set"}
+	}
+	return jc.projectTaskType(jc.options.Projects[0], friendlyname)
+}
+
+//Resolves a task type of a project from its friendly name, e.g. "user-story",
+//or from its actual name, e.g. "User Story".
+func (jc *JiraClient) projectTaskType(projectKey, name string) (string, error) {
+	projmap, err := jc.GetTaskTypes(projectKey)
 	if err != nil {
 		return "", err
 	}
 
-	if taskname, ok := projmap[jc.options.Projects[0]][friendlyname]; ok {
+	if taskname, ok := projmap[projectKey][strings.Replace(strings.ToLower(name), " ", "-", -1)]; ok {
 		return taskname, nil
 	} else {
 		if jc.options.Verbose {
-			fmt.Println(projmap[jc.options.Projects[0]])
+			fmt.Println(projmap[projectKey])
 		}
 
 	}
 
-	return "", &JiraClientError{fmt.Sprintf("Task name not found for friendly name %s.", friendlyname)}
+	return "", &JiraClientError{fmt.Sprintf("Task name not found for friendly name %s.", name)}
 }
 
 func (jc *JiraClient) CreateTask(project string, nto *NewTaskOptions) error {
-	tt, err := jc.GetTaskType(nto.TaskType)
+	key, err := jc.createTask(project, nto)
+	if err != nil || jc.options.DryRun {
+		return err
+	}
+	if jc.options.Verbose {
+		log.Println(fmt.Sprintf("%s successfully created!", key))
+	}
+	return nil
+}
+
+//Creates a copy of an issue and returns the new key.
+//Summary, description, type, parent, labels, components and priority are copied,
+//then any non-empty value in overrides replaces the copied one.
+//The copy is linked to its source when the instance has the "Cloners" link type.
+func (jc *JiraClient) CloneIssue(sourceKey string, overrides *NewTaskOptions) (string, error) {
+	src, err := jc.GetIssue(sourceKey)
+	if err != nil {
+		return "", err
+	}
+	nto := src.ToNewTaskOptions()
+	projectjs, _ := jsonWalker("project/key", src.raw)
+	project, _ := projectjs.(string)
+
+	if overrides != nil {
+		if overrides.TaskType != "" {
+			nto.TaskType = overrides.TaskType
+		}
+		if overrides.Summary != "" {
+			nto.Summary = overrides.Summary
+		}
+		if overrides.Description != "" {
+			nto.Description = overrides.Description
+		}
+		if overrides.Parent != nil {
+			nto.Parent = overrides.Parent
+		}
+		if overrides.Labels != nil {
+			nto.Labels = overrides.Labels
+		}
+		if overrides.Components != nil {
+			nto.Components = overrides.Components
+		}
+		if overrides.Priority != "" {
+			nto.Priority = overrides.Priority
+		}
+		nto.OriginalEstimate = overrides.OriginalEstimate
+		nto.RemainingEstimate = overrides.RemainingEstimate
+		if overrides.SecurityLevel != "" {
+			nto.SecurityLevel = overrides.SecurityLevel
+		}
+		nto.Fields = overrides.Fields
+		nto.SelectFields = overrides.SelectFields
+		nto.CascadingFields = overrides.CascadingFields
+		nto.MultiFields = overrides.MultiFields
+		nto.MultiFieldShapes = overrides.MultiFieldShapes
+	}
+
+	key, err := jc.createTask(project, nto)
+	if err != nil {
+		return "", err
+	}
+	//The link is a nicety, the clone exists either way.
+	err = jc.linkIssues("Cloners", key, sourceKey)
+	if err != nil && jc.options.Verbose {
+		fmt.Println(err)
+	}
+	return key, nil
+}
+
+//Links two issues, reading as "inwardKey <outward description> outwardKey".
+func (jc *JiraClient) linkIssues(linkType, inwardKey, outwardKey string) error {
+	b, err := json.Marshal(msi{
+		"type":         msi{"name": linkType},
+		"inwardIssue":  msi{"key": inwardKey},
+		"outwardIssue": msi{"key": outwardKey}})
 	if err != nil {
 		return err
 	}
-	projmap, err := jc.GetProjects()
+	u := fmt.Sprintf("%s/issueLink", jc.apiUrl())
+	if jc.dryRun("POST", u, b) {
+		return nil
+	}
+	resp, err := jc.Post(u, "application/json", bytes.NewBuffer(b))
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return newApiError(resp, "Could not link issues")
+	}
+	return nil
+}
+
+func (jc *JiraClient) createTask(project string, nto *NewTaskOptions) (string, error) {
+	projmap, err := jc.GetProjects(project)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := projmap[project]; !ok {
+		//project might be a name rather than a key
+		projmap, err = jc.GetProjects()
+		if err != nil {
+			return "", err
+		}
+	}
+	if _, ok := projmap[project]; !ok {
+		return "", &JiraClientError{fmt.Sprintf("Project %s not found", project)}
+	}
+	tt, err := jc.projectTaskType(projmap[project].Key, nto.TaskType)
+	if err != nil {
+		return "", err
+	}
 
 	fields := map[string]interface{}{
 		"summary":   nto.Summary,
@@ -797,8 +2513,37 @@ func (jc *JiraClient) CreateTask(project string, nto *NewTaskOptions) error {
 	if len(nto.Labels) > 0 {
 		fields["labels"] = nto.Labels //tagsFromStringSlice(nto.Labels)
 	}
+	if len(nto.Components) > 0 {
+		components := []interface{}{}
+		for _, c := range nto.Components {
+			components = append(components, msi{"name": c})
+		}
+		fields["components"] = components
+	}
+	if nto.Priority != "" {
+		fields["priority"] = msi{"name": nto.Priority}
+	}
+	if nto.SecurityLevel != "" {
+		id, err := jc.securityLevelId(projmap[project].Key, nto.SecurityLevel)
+		if err != nil {
+			return "", err
+		}
+		fields["security"] = msi{"id": id}
+	}
+	timetracking := map[string]string{}
 	if nto.OriginalEstimate != "" {
-		fields["timetracking"] = map[string]string{"originalEstimate": nto.OriginalEstimate}
+		timetracking["originalEstimate"] = nto.OriginalEstimate
+	}
+	if nto.RemainingEstimate != "" {
+		timetracking["remainingEstimate"] = nto.RemainingEstimate
+	}
+	for _, d := range timetracking {
+		if _, err := ParseJiraDuration(d); err != nil {
+			return "", err
+		}
+	}
+	if len(timetracking) > 0 {
+		fields["timetracking"] = timetracking
 	}
 	for _, field := range nto.Fields {
 		split_f := strings.Split(field, "=")
@@ -818,37 +2563,286 @@ func (jc *JiraClient) CreateTask(project string, nto *NewTaskOptions) error {
 		fval := strings.Join(split_f[1:], "=")
 		fields[fname] = map[string]interface{}{"value": fval}
 	}
+	for fname, values := range nto.MultiFields {
+		shape := nto.MultiFieldShapes[fname]
+		arr := []interface{}{}
+		for _, v := range values {
+			if shape == "" {
+				arr = append(arr, v)
+			} else {
+				arr = append(arr, msi{shape: v})
+			}
+		}
+		fields[fname] = arr
+	}
+	for _, field := range nto.CascadingFields {
+		split_f := strings.SplitN(field, "=", 2)
+		if len(split_f) < 2 {
+			return "", &JiraClientError{fmt.Sprintf("Bad cascading field %q, expected field=parent>child", field)}
+		}
+		levels := strings.SplitN(split_f[1], ">", 2)
+		if len(levels) < 2 || levels[0] == "" || levels[1] == "" {
+			return "", &JiraClientError{fmt.Sprintf("Cascading field %s needs both a parent and a child value, e.g. %s=parent>child", split_f[0], split_f[0])}
+		}
+		fields[split_f[0]] = msi{"value": levels[0], "child": msi{"value": levels[1]}}
+	}
+
+	if jc.options.ValidateFields {
+		err = jc.validateFields(projmap[project].Key, tt, fields)
+		if err != nil {
+			return "", err
+		}
+	}
+	return jc.CreateIssue(fields)
+}
+
+//Checks that all the fields required to create an issue are set.
+func (jc *JiraClient) validateFields(projectKey, issueType string, fields map[string]interface{}) error {
+	meta, err := jc.GetCreateFields(projectKey, issueType)
+	if err != nil {
+		return err
+	}
+	missing := []string{}
+	for _, fm := range meta {
+		if _, ok := fields[fm.Id]; fm.Required && !fm.HasDefault && !ok {
+			missing = append(missing, fmt.Sprintf("%s (%s)", fm.Name, fm.Id))
+		}
+	}
+	if len(missing) > 0 {
+		return &JiraClientError{fmt.Sprintf("Missing required fields: %s", strings.Join(missing, ", "))}
+	}
+	return nil
+}
 
+//Creates an issue from a raw fields map, as Jira expects it.
+//Unlike CreateTask, no metadata lookup is done. Returns the new issue's key.
+func (jc *JiraClient) CreateIssue(fields map[string]interface{}) (string, error) {
 	iss, err := json.Marshal(map[string]interface{}{
 		"fields": fields})
 	if err != nil {
-		return err
+		return "", err
 	}
 	if jc.options.Verbose {
 		fmt.Println(string(iss))
 	}
-	resp, err := jc.Post(fmt.Sprintf("https://%s/rest/api/2/issue", jc.Server), "application/json", bytes.NewBuffer(iss))
+	u := fmt.Sprintf("%s/issue", jc.apiUrl())
+	if jc.dryRun("POST", u, iss) {
+		return "", nil
+	}
+	resp, err := jc.Post(u, "application/json", bytes.NewBuffer(iss))
 	if err != nil {
-		return err
+		return "", err
 	}
+	defer resp.Body.Close()
 	s, _ := ioutil.ReadAll(resp.Body)
 	if resp.StatusCode != 201 {
 
-		return &IssueError{fmt.Sprintf("%d: %s", resp.StatusCode, string(s))}
+		return "", &IssueError{fmt.Sprintf("%d: %s", resp.StatusCode, string(s))}
 	}
 	var js interface{}
 	err = json.Unmarshal(s, &js)
 	if err != nil {
-		return err
+		return "", err
 	}
 	keyjs, _ := jsonWalker("key", js)
 	key, _ := keyjs.(string)
-	log.Println(fmt.Sprintf("%s successfully created!", key))
-	return nil
+	return key, nil
+}
+
+//Representation of a workflow status
+type Status struct {
+	Id       string
+	Name     string
+	Category StatusCategory
+}
+
+//Category of a status, one of "new" (To Do), "indeterminate" (In Progress) or "done".
+type StatusCategory struct {
+	Key       string
+	ColorName string
+}
+
+//Lists all the statuses of the instance.
+func (jc *JiraClient) GetStatuses() ([]Status, error) {
+	obj, err := jc.cachedGet(fmt.Sprintf("%s/status", jc.apiUrl()))
+	if err != nil {
+		return nil, err
+	}
+	result := []Status{}
+	if statuses, ok := obj.([]interface{}); ok {
+		for _, st := range statuses {
+			result = append(result, statusFromIface(st))
+		}
+	}
+	return result, nil
+}
+
+//Lists the statuses used by a project's workflows.
+func (jc *JiraClient) GetProjectStatuses(projectKey string) ([]Status, error) {
+	obj, err := jc.getJson(fmt.Sprintf("%s/project/%s/statuses", jc.apiUrl(), url.PathEscape(projectKey)))
+	if err != nil {
+		return nil, err
+	}
+	result := []Status{}
+	seen := map[string]bool{}
+	//Statuses are listed per issue type, so the same ones show up many times.
+	if issuetypes, ok := obj.([]interface{}); ok {
+		for _, it := range issuetypes {
+			statusesjs, _ := jsonWalker("statuses", it)
+			statuses, _ := statusesjs.([]interface{})
+			for _, st := range statuses {
+				status := statusFromIface(st)
+				if !seen[status.Id] {
+					seen[status.Id] = true
+					result = append(result, status)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+func statusFromIface(obj interface{}) Status {
+	idjs, _ := jsonWalker("id", obj)
+	namejs, _ := jsonWalker("name", obj)
+	catkeyjs, _ := jsonWalker("statusCategory/key", obj)
+	catcolorjs, _ := jsonWalker("statusCategory/colorName", obj)
+	status := Status{}
+	status.Id, _ = idjs.(string)
+	status.Name, _ = namejs.(string)
+	status.Category.Key, _ = catkeyjs.(string)
+	status.Category.ColorName, _ = catcolorjs.(string)
+	return status
+}
+
+const defaultPageSize = 50
+
+func (jc *JiraClient) pageSize() int {
+	if jc.options.PageSize > 0 {
+		return jc.options.PageSize
+	}
+	return defaultPageSize
+}
+
+//Walks through all the pages of a listing and returns the items of every page.
+//itemsPath is where the items are in each page, e.g. "issues", or "" when the page
+//is the array itself. Paging stops on an empty page, on isLast, once total items
+//were read, or, for listings that give neither, on a short page.
+func (jc *JiraClient) fetchAllPages(u, itemsPath string) ([]interface{}, error) {
+	sep := "?"
+	if strings.Contains(u, "?") {
+		sep = "&"
+	}
+	pagesize := jc.pageSize()
+	result := []interface{}{}
+	for {
+		pageUrl := fmt.Sprintf("%s%sstartAt=%d&maxResults=%d", u, sep, len(result), pagesize)
+		if jc.options.Verbose {
+			fmt.Println(pageUrl)
+		}
+		obj, err := jc.getJson(pageUrl)
+		if err != nil {
+			return nil, err
+		}
+		itemsjs := obj
+		if itemsPath != "" {
+			itemsjs, _ = jsonWalker(itemsPath, obj)
+		}
+		items, _ := itemsjs.([]interface{})
+		result = append(result, items...)
+		if len(items) == 0 {
+			break
+		}
+		islastjs, _ := jsonWalker("isLast", obj)
+		if islast, ok := islastjs.(bool); ok {
+			if islast {
+				break
+			}
+			continue
+		}
+		totaljs, _ := jsonWalker("total", obj)
+		if total, ok := totaljs.(float64); ok {
+			if len(result) >= int(total) {
+				break
+			}
+			continue
+		}
+		if len(items) < pagesize {
+			break
+		}
+	}
+	return result, nil
+}
+
+//GETs url and parses the json response, turning error statuses into an ApiError.
+func (jc *JiraClient) getJson(url string) (interface{}, error) {
+	resp, err := jc.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, newApiError(resp, "Request failed")
+	}
+	return JsonToInterface(resp.Body)
+}
+
+//Information about the Jira instance
+type ServerInfo struct {
+	BaseUrl        string
+	Version        string
+	DeploymentType string //"Cloud" or "Server"
+}
+
+func (jc *JiraClient) GetServerInfo() (*ServerInfo, error) {
+	obj, err := jc.cachedGet(fmt.Sprintf("%s/serverInfo", jc.apiUrl()))
+	if err != nil {
+		return nil, err
+	}
+	baseurljs, _ := jsonWalker("baseUrl", obj)
+	versionjs, _ := jsonWalker("version", obj)
+	deploymentjs, _ := jsonWalker("deploymentType", obj)
+	si := &ServerInfo{}
+	si.BaseUrl, _ = baseurljs.(string)
+	si.Version, _ = versionjs.(string)
+	si.DeploymentType, _ = deploymentjs.(string)
+	return si, nil
+}
+
+func (si *ServerInfo) IsCloud() bool {
+	return si.DeploymentType == "Cloud"
 }
 
 func (jc *JiraClient) issueUrl() string {
-	return fmt.Sprintf("https://%s/rest/api/2/issue", jc.Server)
+	return fmt.Sprintf("%s/issue", jc.apiUrl())
+}
+
+//Base url of the REST api, in the version set in the options.
+func (jc *JiraClient) apiUrl() string {
+	version := jc.options.APIVersion
+	if version == "" {
+		version = "2"
+	}
+	return fmt.Sprintf("%s/rest/api/%s", jc.baseUrl(), version)
+}
+
+//Root url of the Jira instance.
+func (jc *JiraClient) baseUrl() string {
+	return serverUrl(jc.Server)
+}
+
+//Turns a server setting into the root url of the instance.
+//The server can be a bare host name, optionally with a port, in which case https is used,
+//or a full url with a scheme and a context path, e.g. "http://localhost:8080/jira".
+func serverUrl(server string) string {
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return strings.TrimRight(server, "/")
+	}
+	return fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, strings.TrimRight(u.Path, "/"))
 }
 
 func PrintHtml(issues []*Issue) ([]byte, error) {
@@ -866,20 +2860,37 @@ func PrintHtml(issues []*Issue) ([]byte, error) {
 }
 
 type JiraProject struct {
-	Name string
-	Key  string
-	Id   string
+	Name           string
+	Key            string
+	Id             string
+	Lead           string
+	Description    string
+	ProjectTypeKey string
+	AvatarURL      string
 }
 
 type NewTaskOptions struct {
-	TaskType         string
-	Summary          string
-	OriginalEstimate string
-	Parent           *Issue
-	Fields           []string
-	SelectFields     []string
-	Labels           []string
-	Description      string
+	TaskType          string
+	Summary           string
+	OriginalEstimate  string
+	RemainingEstimate string
+	Parent            *Issue
+	Fields            []string
+	SelectFields      []string
+	CascadingFields   []string //Cascading selects, as field=parent>child
+	Labels            []string
+	Components        []string
+	Priority          string
+	Description       string
+	SecurityLevel     string //Name or id of the issue security level
+
+	//Multi-value fields, sent as arrays shaped by MultiFieldShapes.
+	MultiFields map[string][]string
+	//Key wrapping each value of a MultiFields field:
+	//"value" for multi-selects and checkboxes, "name" for user pickers on Server,
+	//versions and components, "accountId" for user pickers on Cloud.
+	//Fields without a shape, like labels, are sent as plain strings.
+	MultiFieldShapes map[string]string
 }
 
 func (jc *JiraClient) ChangeRank(rankthese []string, before_or_after string, target string) error {
@@ -899,14 +2910,17 @@ func (jc *JiraClient) ChangeRank(rankthese []string, before_or_after string, tar
 		return fmt.Errorf("before_or_after needs to be set to either 'before' or 'after'.")
 	}
 	err := enc.Encode(map[string]interface{}{"issueKeys": rankthese, "customFieldId": 10560, b_o_f: target})
-	fmt.Println(b.String())
+	if jc.options.Verbose {
+		fmt.Println(b.String())
+	}
 	if err != nil {
 		return err
 	}
-	res, err := jc.Put(fmt.Sprintf("https://%s/rest/greenhopper/1.0/api/rank/%s/", jc.Server, before_or_after), "application/json", b)
+	res, err := jc.Put(fmt.Sprintf("%s/rest/greenhopper/1.0/api/rank/%s/", jc.baseUrl(), before_or_after), "application/json", b)
 	if err != nil {
 		return err
 	}
+	defer res.Body.Close()
 	if res.StatusCode >= 400 {
 		msg, err := ioutil.ReadAll(res.Body)
 		if err != nil {
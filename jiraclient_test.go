@@ -0,0 +1,681 @@
+package libgojira
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//Fake Jira answering with handler. The field list is served empty so
+//parsing issues needs no extra setup.
+func testHandler(handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/field") {
+			fmt.Fprint(w, "[]")
+			return
+		}
+		handler(w, r)
+	})
+}
+
+//Starts a fake Jira and a client pointed at it.
+func newTestClient(t *testing.T, options Options, handler http.HandlerFunc) (*JiraClient, *httptest.Server) {
+	srv := httptest.NewServer(testHandler(handler))
+	t.Cleanup(srv.Close)
+	options.Server = srv.URL
+	return NewJiraClientWithHTTPClient(options, srv.Client()), srv
+}
+
+//Json of an issue with only the fields NewIssueFromIface requires.
+func testIssue(key string) map[string]interface{} {
+	return map[string]interface{}{
+		"key": key,
+		"fields": map[string]interface{}{
+			"issuetype": map[string]interface{}{"name": "Bug"},
+			"summary":   "Summary of " + key,
+			"comment":   map[string]interface{}{"comments": []interface{}{}},
+		},
+	}
+}
+
+func writeJson(t *testing.T, w http.ResponseWriter, obj interface{}) {
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
+		t.Error(err)
+	}
+}
+
+//Round trips through json, to get the types the decoder produces.
+func fromJson(t *testing.T, obj interface{}) interface{} {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result interface{}
+	if err := json.Unmarshal(b, &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestSearchPages(t *testing.T) {
+	const total = 120
+	starts := []int{}
+	jc, _ := newTestClient(t, Options{PageSize: 50}, func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.Atoi(r.URL.Query().Get("startAt"))
+		max, _ := strconv.Atoi(r.URL.Query().Get("maxResults"))
+		starts = append(starts, start)
+		issues := []interface{}{}
+		for i := start; i < start+max && i < total; i++ {
+			issues = append(issues, testIssue(fmt.Sprintf("TEST-%d", i)))
+		}
+		writeJson(t, w, map[string]interface{}{"startAt": start, "maxResults": max, "total": total, "issues": issues})
+	})
+	issues, err := jc.Search(&SearchOptions{JQL: "project = TEST"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != total {
+		t.Fatalf("got %d issues, want %d", len(issues), total)
+	}
+	for i, iss := range issues {
+		if want := fmt.Sprintf("TEST-%d", i); iss.Key != want {
+			t.Fatalf("issue %d is %s, want %s", i, iss.Key, want)
+		}
+	}
+	if fmt.Sprint(starts) != "[0 50 100]" {
+		t.Fatalf("pages started at %v", starts)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	for _, status := range []int{400, 401, 404, 500, 503} {
+		jc, _ := newTestClient(t, Options{}, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			writeJson(t, w, map[string]interface{}{
+				"errorMessages": []string{"Something broke"},
+				"errors":        map[string]string{"jql": "Bad query"},
+			})
+		})
+		calls := map[string]func() error{
+			"Search": func() error {
+				_, err := jc.Search(&SearchOptions{JQL: "project = TEST"})
+				return err
+			},
+			"GetIssue": func() error {
+				_, err := jc.GetIssue("TEST-1")
+				return err
+			},
+		}
+		for name, call := range calls {
+			err := call()
+			ae, ok := err.(*ApiError)
+			if !ok {
+				t.Fatalf("%s on %d: got %T %v, want *ApiError", name, status, err, err)
+			}
+			if ae.StatusCode != status {
+				t.Errorf("%s on %d: got status %d", name, status, ae.StatusCode)
+			}
+			if len(ae.ErrorMessages) != 1 || ae.ErrorMessages[0] != "Something broke" || ae.Errors["jql"] != "Bad query" {
+				t.Errorf("%s on %d: messages not read from the body: %v", name, status, ae)
+			}
+		}
+	}
+}
+
+func TestNewIssueFromIface(t *testing.T) {
+	jc, _ := newTestClient(t, Options{}, func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+
+	iss, err := jc.NewIssueFromIface(fromJson(t, testIssue("TEST-1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iss.Key != "TEST-1" || iss.Type != "Bug" || iss.Summary != "Summary of TEST-1" {
+		t.Errorf("required fields not read: %+v", iss)
+	}
+	if iss.Description != "" || iss.Status != "" || iss.Assignee != "" || iss.Parent != "" {
+		t.Errorf("missing optional fields should be empty: %+v", iss)
+	}
+	if iss.DueDate != nil || !iss.Created.IsZero() || iss.Sprint != nil {
+		t.Errorf("missing dates and sprint should be unset: %+v", iss)
+	}
+	if iss.Files == nil || len(iss.Files) != 0 || len(iss.Comments) != 0 {
+		t.Errorf("got %d files and %d comments, want none", len(iss.Files), len(iss.Comments))
+	}
+
+	obj := testIssue("TEST-2")
+	fields := obj["fields"].(map[string]interface{})
+	fields["attachment"] = []interface{}{}
+	fields["duedate"] = "2024-03-01"
+	fields["parent"] = map[string]interface{}{"key": "TEST-1"}
+	iss, err = jc.NewIssueFromIface(fromJson(t, obj))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iss.Files == nil || len(iss.Files) != 0 {
+		t.Errorf("empty attachment array gave %v", iss.Files)
+	}
+	if iss.DueDate == nil || iss.DueDate.Format(JIRA_DATE_FORMAT) != "2024-03-01" {
+		t.Errorf("got due date %v", iss.DueDate)
+	}
+	if iss.Parent != "TEST-1" {
+		t.Errorf("got parent %q", iss.Parent)
+	}
+
+	fields["attachment"] = []interface{}{
+		map[string]interface{}{"id": "10", "filename": "log.txt", "content": "http://jira/att/10", "self": "http://jira/api/attachment/10", "size": 42},
+		map[string]interface{}{"id": "11"},
+	}
+	iss, err = jc.NewIssueFromIface(fromJson(t, obj))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(iss.Files) != 1 || iss.Files[0].Name() != "log.txt" || iss.Files[0].Size != 42 {
+		t.Errorf("got files %v, want only log.txt", iss.Files)
+	}
+
+	if _, err := jc.NewIssueFromIface(fromJson(t, map[string]interface{}{"key": "TEST-3"})); err == nil {
+		t.Error("issue without fields parsed")
+	}
+}
+
+func TestConnectionReuse(t *testing.T) {
+	srv := httptest.NewUnstartedServer(testHandler(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/issue/TEST-404"):
+			w.WriteHeader(404)
+			writeJson(t, w, map[string]interface{}{"errorMessages": []string{"Issue does not exist"}})
+		case strings.Contains(r.URL.Path, "/issue/"):
+			writeJson(t, w, testIssue("TEST-1"))
+		default:
+			writeJson(t, w, map[string]interface{}{"total": 1, "issues": []interface{}{testIssue("TEST-1")}})
+		}
+	}))
+	var mu sync.Mutex
+	conns := 0
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+	jc := NewJiraClientWithHTTPClient(Options{Server: srv.URL}, srv.Client())
+	for i := 0; i < 50; i++ {
+		if _, err := jc.Search(&SearchOptions{JQL: "project = TEST"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := jc.GetIssue("TEST-1"); err != nil {
+			t.Fatal(err)
+		}
+		//Error responses have to be drained and closed too.
+		if _, err := jc.GetIssue("TEST-404"); err == nil {
+			t.Fatal("missing issue found")
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if conns != 1 {
+		t.Fatalf("150 sequential calls opened %d connections, want 1", conns)
+	}
+}
+
+//Run with -race: clients with different options share nothing but the server,
+//and copies made by WithProject share their caches.
+func TestConcurrentClients(t *testing.T) {
+	handler := testHandler(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/issue/") {
+			w.Header().Set("ETag", `"1"`)
+			writeJson(t, w, testIssue("TEST-1"))
+			return
+		}
+		start, _ := strconv.Atoi(r.URL.Query().Get("startAt"))
+		max, _ := strconv.Atoi(r.URL.Query().Get("maxResults"))
+		issues := []interface{}{}
+		for i := start; i < start+max && i < 30; i++ {
+			issues = append(issues, testIssue(fmt.Sprintf("TEST-%d", i)))
+		}
+		writeJson(t, w, map[string]interface{}{"total": 30, "issues": issues})
+	})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	base := NewJiraClientWithHTTPClient(Options{Server: srv.URL, PageSize: 7, CacheIssues: true}, srv.Client())
+	clients := []*JiraClient{
+		base,
+		base.WithProject("OTHER"),
+		NewJiraClientWithHTTPClient(Options{Server: srv.URL, LaxIssueKeys: true, MetaCacheTTL: -1}, srv.Client()),
+		NewJiraClientWithHTTPClient(Options{Server: srv.URL, RateLimit: 1000}, srv.Client()),
+	}
+	var wg sync.WaitGroup
+	for _, jc := range clients {
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(jc *JiraClient) {
+				defer wg.Done()
+				issues, err := jc.Search(&SearchOptions{JQL: "project = TEST"})
+				if err != nil || len(issues) != 30 {
+					t.Errorf("got %d issues, %v", len(issues), err)
+				}
+				if _, err := jc.GetIssue("TEST-1"); err != nil {
+					t.Error(err)
+				}
+			}(jc)
+		}
+	}
+	wg.Wait()
+}
+
+//Runs f with stdout and the standard logger captured, returning what they got.
+func captureOutput(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer func() {
+		os.Stdout = stdout
+		log.SetOutput(os.Stderr)
+	}()
+	done := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		done <- b
+	}()
+	f()
+	w.Close()
+	return string(<-done) + logged.String()
+}
+
+func TestQuietClient(t *testing.T) {
+	var srvUrl string
+	jc, srv := newTestClient(t, Options{Projects: []string{"TEST"}}, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/issue/createmeta"):
+			writeJson(t, w, map[string]interface{}{"projects": []interface{}{map[string]interface{}{
+				"id": "1", "key": "TEST", "name": "Test",
+				"issuetypes": []interface{}{map[string]interface{}{"name": "Bug"}},
+			}}})
+		case strings.HasSuffix(r.URL.Path, "/attachments"):
+			writeJson(t, w, []interface{}{map[string]interface{}{
+				"id": "10", "filename": "upload.txt", "content": srvUrl + "/att/10", "self": srvUrl + "/rest/api/2/attachment/10",
+			}})
+		case strings.Contains(r.URL.Path, "/attachment/"):
+			w.WriteHeader(204)
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/issue"):
+			w.WriteHeader(201)
+			writeJson(t, w, map[string]interface{}{"key": "TEST-2"})
+		case r.Method == "PUT":
+			w.WriteHeader(204)
+		case strings.Contains(r.URL.Path, "/issue/"):
+			iss := testIssue("TEST-1")
+			iss["fields"].(map[string]interface{})["attachment"] = []interface{}{map[string]interface{}{
+				"id": "10", "filename": "upload.txt", "content": srvUrl + "/att/10", "self": srvUrl + "/rest/api/2/attachment/10",
+			}}
+			writeJson(t, w, iss)
+		default:
+			//The second issue can't be parsed, which used to be printed.
+			writeJson(t, w, map[string]interface{}{"total": 2, "issues": []interface{}{testIssue("TEST-1"), map[string]interface{}{"key": "TEST-3"}}})
+		}
+	})
+	srvUrl = srv.URL
+	file := filepath.Join(t.TempDir(), "upload.txt")
+	if err := ioutil.WriteFile(file, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := captureOutput(t, func() {
+		if _, err := jc.Search(&SearchOptions{JQL: "project = TEST"}); err != nil {
+			t.Error(err)
+		}
+		if _, err := jc.GetIssue("TEST-1"); err != nil {
+			t.Error(err)
+		}
+		if err := jc.Upload("TEST-1", file); err != nil {
+			t.Error(err)
+		}
+		if err := jc.DelAttachment("TEST-1", "upload.txt"); err != nil {
+			t.Error(err)
+		}
+		if err := jc.CreateTask("TEST", &NewTaskOptions{TaskType: "bug", Summary: "New bug"}); err != nil {
+			t.Error(err)
+		}
+		if err := jc.SetDescription("TEST-1", "New description"); err != nil {
+			t.Error(err)
+		}
+	})
+	if out != "" {
+		t.Errorf("non-verbose client printed:\n%s", out)
+	}
+}
+
+func TestFetchAllPages(t *testing.T) {
+	cases := []struct {
+		name      string
+		itemsPath string
+		pages     []string
+		want      int
+	}{
+		{"isLast", "values", []string{
+			`{"isLast": false, "values": [1, 2]}`,
+			`{"isLast": false, "values": [3]}`,
+			`{"isLast": true, "values": [4]}`,
+		}, 4},
+		{"total", "issues", []string{
+			`{"total": 5, "issues": [1, 2]}`,
+			`{"total": 5, "issues": [3, 4]}`,
+			`{"total": 5, "issues": [5]}`,
+		}, 5},
+		{"total on a full page", "issues", []string{
+			`{"total": 4, "issues": [1, 2]}`,
+			`{"total": 4, "issues": [3, 4]}`,
+		}, 4},
+		{"short page", "", []string{
+			`[1, 2]`,
+			`[3]`,
+		}, 3},
+		{"empty page", "", []string{
+			`[1, 2]`,
+			`[3, 4]`,
+			`[]`,
+		}, 4},
+		{"empty page under total", "values", []string{
+			`{"total": 10, "values": [1, 2]}`,
+			`{"total": 10, "values": []}`,
+		}, 2},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			requests, served := 0, 0
+			jc, _ := newTestClient(t, Options{PageSize: 2}, func(w http.ResponseWriter, r *http.Request) {
+				if requests >= len(c.pages) {
+					t.Errorf("request past the last page: %s", r.URL)
+					fmt.Fprint(w, "[]")
+					return
+				}
+				//Pages start after the items read so far, whatever their size.
+				if start := r.URL.Query().Get("startAt"); start != strconv.Itoa(served) || r.URL.Query().Get("maxResults") != "2" {
+					t.Errorf("page %d requested as %s", requests, r.URL.RawQuery)
+				}
+				fmt.Fprint(w, c.pages[requests])
+				var page interface{}
+				json.Unmarshal([]byte(c.pages[requests]), &page)
+				if c.itemsPath != "" {
+					page, _ = jsonWalker(c.itemsPath, page)
+				}
+				served += len(page.([]interface{}))
+				requests++
+			})
+			items, err := jc.fetchAllPages(jc.apiUrl()+"/list", c.itemsPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != c.want {
+				t.Errorf("got %d items, want %d", len(items), c.want)
+			}
+			for i, item := range items {
+				if item != float64(i+1) {
+					t.Errorf("item %d is %v", i, item)
+				}
+			}
+			if requests != len(c.pages) {
+				t.Errorf("made %d requests, want %d", requests, len(c.pages))
+			}
+		})
+	}
+}
+
+func TestCompressedResponses(t *testing.T) {
+	for _, encoding := range []string{"gzip", "deflate"} {
+		for _, manual := range []bool{false, true} {
+			options := Options{}
+			if manual {
+				//Setting the header by hand turns off the transport's own decoding.
+				options.Headers = map[string]string{"Accept-Encoding": encoding}
+			}
+			jc, _ := newTestClient(t, options, func(w http.ResponseWriter, r *http.Request) {
+				var b bytes.Buffer
+				var zw io.WriteCloser = gzip.NewWriter(&b)
+				if encoding == "deflate" {
+					zw = zlib.NewWriter(&b)
+				}
+				json.NewEncoder(zw).Encode(testIssue("TEST-1"))
+				zw.Close()
+				//Sent whatever the request asked for, like a misbehaving proxy would.
+				w.Header().Set("Content-Encoding", encoding)
+				w.Write(b.Bytes())
+			})
+			iss, err := jc.GetIssue("TEST-1")
+			if err != nil {
+				t.Fatalf("%s, header set by hand: %v: %v", encoding, manual, err)
+			}
+			if iss.Key != "TEST-1" || iss.Summary != "Summary of TEST-1" {
+				t.Errorf("%s, header set by hand: %v: got %+v", encoding, manual, iss)
+			}
+		}
+	}
+}
+
+func TestDryRunSendsNoChanges(t *testing.T) {
+	var srvUrl string
+	jc, srv := newTestClient(t, Options{DryRun: true, Projects: []string{"TEST"}}, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Errorf("dry run sent %s %s", r.Method, r.URL)
+		}
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/serverInfo"):
+			writeJson(t, w, map[string]interface{}{"deploymentType": "Server"})
+		case strings.Contains(r.URL.Path, "/issue/"):
+			iss := testIssue("TEST-1")
+			iss["fields"].(map[string]interface{})["attachment"] = []interface{}{map[string]interface{}{
+				"id": "10", "filename": "old.txt", "content": srvUrl + "/att/10", "self": srvUrl + "/rest/api/2/attachment/10",
+			}}
+			writeJson(t, w, iss)
+		default:
+			fmt.Fprint(w, "{}")
+		}
+	})
+	srvUrl = srv.URL
+	file := filepath.Join(t.TempDir(), "new.txt")
+	if err := ioutil.WriteFile(file, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	iss := &Issue{Key: "TEST-1"}
+
+	calls := map[string]func() error{
+		"Link": func() error {
+			return jc.Link(&Link{Issue: "TEST-1", LinkReason: "Blocks", LinkedToIssue: "TEST-2"})
+		},
+		"AddComment": func() error {
+			_, err := jc.AddComment("TEST-1", "A comment")
+			return err
+		},
+		"DelComment":    func() error { return jc.DelComment("TEST-1", "10") },
+		"DelWorkLog":    func() error { return jc.DelWorkLog("TEST-1", "10") },
+		"Vote":          func() error { return jc.Vote("TEST-1") },
+		"Unvote":        func() error { return jc.Unvote("TEST-1") },
+		"Upload":        func() error { return jc.Upload("TEST-1", file) },
+		"DelAttachment": func() error { return jc.DelAttachment("TEST-1", "old.txt") },
+		"ReplaceAttachment": func() error {
+			_, err := jc.ReplaceAttachment("TEST-1", "old.txt", file)
+			return err
+		},
+		"ChangeRank": func() error { return jc.ChangeRank([]string{"TEST-1"}, "before", "TEST-2") },
+		"Do": func() error {
+			_, err := jc.Do("POST", "/issue/TEST-1/watchers", "user")
+			return err
+		},
+		"Assign":              func() error { return iss.Assign("user", jc) },
+		"MoveIssuesToSprint":  func() error { return jc.MoveIssuesToSprint(1, []string{"TEST-1"}) },
+		"MoveIssuesToBacklog": func() error { return jc.MoveIssuesToBacklog([]string{"TEST-1"}) },
+		"AddIssuesToEpic":     func() error { return jc.AddIssuesToEpic("TEST-2", []string{"TEST-1"}) },
+		"CreateFilter": func() error {
+			_, err := jc.CreateFilter("Mine", "assignee = currentUser()", false)
+			return err
+		},
+		"AddRemoteLink": func() error { return jc.AddRemoteLink("TEST-1", "https://example.com", "Example") },
+		"AddWatcher":    func() error { return jc.AddWatcher("TEST-1", "user") },
+		"RemoveWatcher": func() error { return jc.RemoveWatcher("TEST-1", "user") },
+		"UpdateIssue": func() error {
+			return jc.UpdateIssue("TEST-1", map[string]interface{}{"labels": []interface{}{map[string]interface{}{"add": "x"}}})
+		},
+	}
+	captureOutput(t, func() {
+		for name, call := range calls {
+			if err := call(); err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+		}
+	})
+}
+
+func TestWorklogPages(t *testing.T) {
+	worklog := func(i int) map[string]interface{} {
+		return map[string]interface{}{"id": strconv.Itoa(i), "author": map[string]interface{}{"name": "user"},
+			"started": "2024-01-02T10:00:00.000+0000", "timeSpentSeconds": 60}
+	}
+	for _, fail := range []bool{false, true} {
+		jc, _ := newTestClient(t, Options{PageSize: 10}, func(w http.ResponseWriter, r *http.Request) {
+			if fail {
+				w.WriteHeader(503)
+				return
+			}
+			start, _ := strconv.Atoi(r.URL.Query().Get("startAt"))
+			logs := []interface{}{}
+			for i := start; i < start+10 && i < 45; i++ {
+				logs = append(logs, worklog(i))
+			}
+			writeJson(t, w, map[string]interface{}{"total": 45, "worklogs": logs})
+		})
+		embedded := []interface{}{}
+		for i := 0; i < 20; i++ {
+			embedded = append(embedded, worklog(i))
+		}
+		obj := testIssue("TEST-1")
+		obj["fields"].(map[string]interface{})["worklog"] = map[string]interface{}{"total": 45, "maxResults": 20, "worklogs": embedded}
+		js := fromJson(t, obj)
+		iss, err := jc.NewIssueFromIface(js)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 45 * 60
+		if fail {
+			//The embedded worklogs are kept when the others can't be read.
+			want = 20 * 60
+		}
+		if got := iss.TimeLog.SumForMap(); got != want {
+			t.Errorf("failing pages: %v, got %d seconds logged, want %d", fail, got, want)
+		}
+		logsjs, _ := jsonWalker("fields/worklog/worklogs", js)
+		if logs, _ := logsjs.([]interface{}); len(logs) != 20 {
+			t.Errorf("the parsed json was changed, it now has %d worklogs", len(logs))
+		}
+	}
+}
+
+func TestFieldLookupRetried(t *testing.T) {
+	fieldCalls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/field") {
+			fieldCalls++
+			if fieldCalls == 1 {
+				w.WriteHeader(503)
+				return
+			}
+			writeJson(t, w, []interface{}{map[string]interface{}{"id": "customfield_10002", "name": "Story Points", "custom": true}})
+			return
+		}
+		iss := testIssue("TEST-1")
+		iss["fields"].(map[string]interface{})["customfield_10002"] = 5
+		writeJson(t, w, map[string]interface{}{"total": 1, "issues": []interface{}{iss}})
+	}))
+	defer srv.Close()
+	jc := NewJiraClientWithHTTPClient(Options{Server: srv.URL, MetaCacheTTL: -1}, srv.Client())
+	for i, want := range []float64{0, 5, 5} {
+		issues, err := jc.Search(&SearchOptions{JQL: "project = TEST"})
+		if err != nil || len(issues) != 1 {
+			t.Fatalf("search %d: got %d issues, %v", i, len(issues), err)
+		}
+		if issues[0].StoryPoints != want {
+			t.Errorf("search %d: got %v story points, want %v", i, issues[0].StoryPoints, want)
+		}
+	}
+	//A failure is retried, a success is kept.
+	if fieldCalls != 2 {
+		t.Errorf("field list fetched %d times, want 2", fieldCalls)
+	}
+}
+
+func TestGetIssues(t *testing.T) {
+	queries := []string{}
+	jc, _ := newTestClient(t, Options{}, func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		if r.URL.Query().Get("validateQuery") != "warn" {
+			w.WriteHeader(400)
+			return
+		}
+		//TEST-9 doesn't exist.
+		writeJson(t, w, map[string]interface{}{"total": 2, "issues": []interface{}{testIssue("TEST-2"), testIssue("TEST-1")}})
+	})
+	issues, err := jc.GetIssues([]string{"TEST-1", "TEST-9", "TEST-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 2 || issues[0].Key != "TEST-1" || issues[1].Key != "TEST-2" {
+		t.Errorf("got %v", issues)
+	}
+	if len(queries) != 1 || !strings.Contains(queries[0], "jql="+url.QueryEscape("issue in (TEST-1,TEST-9,TEST-2)")+"&") {
+		t.Errorf("searched with %v", queries)
+	}
+
+	queries = nil
+	if _, err := jc.GetIssues([]string{"TEST-1", "A-1) or project = SECRET&fields=x"}); err == nil {
+		t.Error("bad key accepted")
+	}
+	if len(queries) != 0 {
+		t.Errorf("searched with a bad key: %v", queries)
+	}
+}
+
+func TestSetOptions(t *testing.T) {
+	SetOptions(Options{Server: "jira.example.com", User: "user", Passwd: "secret"})
+	jc, err := DefaultClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := DefaultClient(); again != jc {
+		t.Error("DefaultClient built a new client without new options")
+	}
+	SetOptions(Options{Server: "other.example.com", User: "user", Passwd: "secret"})
+	jc, err = DefaultClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jc.Server != "other.example.com" {
+		t.Errorf("got server %s after SetOptions", jc.Server)
+	}
+	SetOptions(Options{})
+	if _, err := DefaultClient(); err == nil {
+		t.Error("client built without a server")
+	}
+}
@@ -0,0 +1,103 @@
+package libgojira
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//Fills in missing credentials, explicit options first, then the
+//JIRA_USER/JIRA_TOKEN environment variables, then the netrc entry of host.
+func resolveCredentials(host, user, passwd string) (string, string) {
+	if user == "" {
+		user = os.Getenv("JIRA_USER")
+	}
+	if passwd == "" {
+		passwd = os.Getenv("JIRA_TOKEN")
+	}
+	if passwd != "" {
+		return user, passwd
+	}
+	login, password, ok := netrcLookup(host)
+	if !ok {
+		return user, passwd
+	}
+	if user == "" {
+		user = login
+	}
+	//Don't pair a user with somebody else's password.
+	if user == login {
+		passwd = password
+	}
+	return user, passwd
+}
+
+//Finds the login and password for host in the netrc file, $NETRC or ~/.netrc.
+func netrcLookup(host string) (string, string, bool) {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", false
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", "", false
+	}
+	return parseNetrc(string(b), host)
+}
+
+func parseNetrc(content, host string) (string, string, bool) {
+	var login, password string
+	matching, found := false, false
+	tokens := []string{}
+	inMacro := false
+	for _, line := range strings.Split(content, "\n") {
+		//Macro definitions run until the next blank line.
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		fields := strings.Fields(line)
+		for k, f := range fields {
+			if f == "macdef" {
+				fields = fields[:k]
+				inMacro = true
+				break
+			}
+		}
+		tokens = append(tokens, fields...)
+	}
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine", "default":
+			if found {
+				return login, password, true
+			}
+			if tokens[i] == "default" {
+				matching = true
+			} else if i+1 < len(tokens) {
+				i++
+				matching = tokens[i] == host
+			}
+			found = matching
+		case "login", "password", "account":
+			if i+1 >= len(tokens) {
+				break
+			}
+			i++
+			if !matching {
+				continue
+			}
+			if tokens[i-1] == "login" {
+				login = tokens[i]
+			} else if tokens[i-1] == "password" {
+				password = tokens[i]
+			}
+		}
+	}
+	return login, password, found
+}
@@ -0,0 +1,30 @@
+package libgojira
+
+import (
+	"sync"
+	"time"
+)
+
+//Spaces requests out so no more than a set number go out each second.
+type rateLimiter struct {
+	sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+//Blocks until the next request may be sent.
+func (rl *rateLimiter) wait() {
+	rl.Lock()
+	now := time.Now()
+	if rl.next.Before(now) {
+		rl.next = now
+	}
+	delay := rl.next.Sub(now)
+	rl.next = rl.next.Add(rl.interval)
+	rl.Unlock()
+	time.Sleep(delay)
+}
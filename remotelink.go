@@ -0,0 +1,82 @@
+package libgojira
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+//A link from an issue to an outside resource, like a build or a pull request.
+type RemoteLink struct {
+	Id           int
+	Url          string
+	Title        string
+	IconUrl      string //16x16 icon shown next to the link, optional
+	Relationship string //Describes the link, e.g. "mentioned in", optional
+}
+
+func (rl *RemoteLink) String() string {
+	return fmt.Sprintf("%s: %s", rl.Title, rl.Url)
+}
+
+//Links a web page to an issue.
+func (jc *JiraClient) AddRemoteLink(issueKey, url, title string) error {
+	return jc.AddRemoteLinkWithDetails(issueKey, RemoteLink{Url: url, Title: title})
+}
+
+//Links a web page to an issue, with the link's icon and relationship when set.
+func (jc *JiraClient) AddRemoteLinkWithDetails(issueKey string, link RemoteLink) error {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return err
+	}
+	object := msi{"url": link.Url, "title": link.Title}
+	if link.IconUrl != "" {
+		object["icon"] = msi{"url16x16": link.IconUrl}
+	}
+	body := msi{"object": object}
+	if link.Relationship != "" {
+		body["relationship"] = link.Relationship
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := jc.Post(fmt.Sprintf("%s/%s/remotelink", jc.issueUrl(), issueKey), "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return newApiError(resp, "Could not add remote link")
+	}
+	return nil
+}
+
+//Lists the web links of an issue.
+func (jc *JiraClient) GetRemoteLinks(issueKey string) ([]RemoteLink, error) {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return nil, err
+	}
+	obj, err := jc.getJson(fmt.Sprintf("%s/%s/remotelink", jc.issueUrl(), issueKey))
+	if err != nil {
+		return nil, err
+	}
+	result := []RemoteLink{}
+	links, _ := obj.([]interface{})
+	for _, l := range links {
+		idjs, _ := jsonWalker("id", l)
+		urljs, _ := jsonWalker("object/url", l)
+		titlejs, _ := jsonWalker("object/title", l)
+		iconjs, _ := jsonWalker("object/icon/url16x16", l)
+		reljs, _ := jsonWalker("relationship", l)
+		link := RemoteLink{}
+		id, _ := idjs.(float64)
+		link.Id = int(id)
+		link.Url, _ = urljs.(string)
+		link.Title, _ = titlejs.(string)
+		link.IconUrl, _ = iconjs.(string)
+		link.Relationship, _ = reljs.(string)
+		result = append(result, link)
+	}
+	return result, nil
+}
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"regexp"
 	"sort"
+	"strconv"
 	"text/template"
 	"time"
 )
@@ -47,6 +49,57 @@ func PrettySeconds(seconds int) string {
 
 }
 
+//Formats a duration the way Jira writes them, e.g. "2h 30m".
+//Days and weeks are left out since their length depends on the instance's working hours.
+//Negative durations get a leading minus sign, e.g. "-1h 30m".
+func FormatJiraDuration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	minutes := int(d / time.Minute)
+	hours := minutes / 60
+	minutes = minutes % 60
+	switch {
+	case hours > 0 && minutes > 0:
+		return fmt.Sprintf("%s%dh %dm", sign, hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%s%dh", sign, hours)
+	case minutes == 0:
+		return "0m"
+	}
+	return fmt.Sprintf("%s%dm", sign, minutes)
+}
+
+//Jira durations, e.g. "1w 2d 3h 30m"
+var durationregex *regexp.Regexp = regexp.MustCompile(`^\s*([0-9]+(\.[0-9]+)?[wdhm]\s*)+$`)
+var durationpartregex *regexp.Regexp = regexp.MustCompile(`([0-9]+(?:\.[0-9]+)?)([wdhm])`)
+
+//Length of the duration units, using Jira's default 8 hour days and 5 day weeks.
+var durationunits = map[string]time.Duration{
+	"w": 5 * 8 * time.Hour,
+	"d": 8 * time.Hour,
+	"h": time.Hour,
+	"m": time.Minute,
+}
+
+//Parses a Jira duration like "1w 2d 3h 30m".
+func ParseJiraDuration(s string) (time.Duration, error) {
+	if !durationregex.MatchString(s) {
+		return 0, &JiraClientError{fmt.Sprintf("Bad duration %q, expected something like \"3h 30m\"", s)}
+	}
+	var d time.Duration
+	for _, part := range durationpartregex.FindAllStringSubmatch(s, -1) {
+		n, err := strconv.ParseFloat(part[1], 64)
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(n * float64(durationunits[part[2]]))
+	}
+	return d, nil
+}
+
 func (tl TimeLog) Percentage() string {
 	if tl.Issue.OriginalEstimate == 0 {
 		return "N/A"
@@ -152,3 +205,4 @@ func TimeLogForIssue(issue *Issue, issue_json interface{}) TimeLogMap {
 }
 
 const JIRA_TIME_FORMAT = "2006-01-02T15:04:05.000-0700"
+const JIRA_DATE_FORMAT = "2006-01-02"
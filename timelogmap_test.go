@@ -0,0 +1,31 @@
+package libgojira
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatJiraDuration(t *testing.T) {
+	cases := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0m"},
+		{30 * time.Second, "0m"},
+		{-30 * time.Second, "0m"},
+		{45 * time.Minute, "45m"},
+		{2 * time.Hour, "2h"},
+		{90 * time.Minute, "1h 30m"},
+		{-90 * time.Minute, "-1h 30m"},
+		{-2 * time.Hour, "-2h"},
+		{-45 * time.Minute, "-45m"},
+		//No days or weeks, their length depends on the instance.
+		{7*24*time.Hour + 15*time.Minute, "168h 15m"},
+		{-2 * 7 * 24 * time.Hour, "-336h"},
+	}
+	for _, c := range cases {
+		if got := FormatJiraDuration(c.d); got != c.want {
+			t.Errorf("FormatJiraDuration(%v) = %q, want %q", c.d, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package libgojira
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+//Representation of a Jira user.
+//Name is only set on Server, AccountId only on Cloud.
+type User struct {
+	Name        string
+	AccountId   string
+	DisplayName string
+	Email       string
+	Active      bool
+}
+
+func (u *User) String() string {
+	return fmt.Sprintf("%s (%s)", u.DisplayName, u.Id())
+}
+
+//Returns the identifier to use when assigning or mentioning the user.
+func (u *User) Id() string {
+	if u.AccountId != "" {
+		return u.AccountId
+	}
+	return u.Name
+}
+
+//Searches users by name, username or email.
+func (jc *JiraClient) SearchUsers(query string) ([]User, error) {
+	si, err := jc.GetServerInfo()
+	if err != nil {
+		return nil, err
+	}
+	param := "username"
+	if si.IsCloud() {
+		param = "query"
+	}
+	return jc.getUsers(fmt.Sprintf("%s/user/search?%s=%s", jc.apiUrl(), param, url.QueryEscape(query)))
+}
+
+func (jc *JiraClient) getUsers(u string) ([]User, error) {
+	resp, err := jc.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, newApiError(resp, "Could not get users")
+	}
+	obj, err := JsonToInterface(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	result := []User{}
+	if users, ok := obj.([]interface{}); ok {
+		for _, v := range users {
+			result = append(result, userFromIface(v))
+		}
+	}
+	return result, nil
+}
+
+func userFromIface(obj interface{}) User {
+	namejs, _ := jsonWalker("name", obj)
+	accountjs, _ := jsonWalker("accountId", obj)
+	displayjs, _ := jsonWalker("displayName", obj)
+	emailjs, _ := jsonWalker("emailAddress", obj)
+	activejs, _ := jsonWalker("active", obj)
+	user := User{}
+	user.Name, _ = namejs.(string)
+	user.AccountId, _ = accountjs.(string)
+	user.DisplayName, _ = displayjs.(string)
+	user.Email, _ = emailjs.(string)
+	user.Active, _ = activejs.(bool)
+	return user
+}
+
+//Lists the users that can be assigned issues in a project.
+//Passing an issue key narrows the list to the users assignable to that issue.
+func (jc *JiraClient) GetAssignableUsers(projectKey string, issueKey ...string) ([]User, error) {
+	u := fmt.Sprintf("%s/user/assignable/search?project=%s", jc.apiUrl(), url.QueryEscape(projectKey))
+	if len(issueKey) > 0 && issueKey[0] != "" {
+		u += "&issueKey=" + url.QueryEscape(issueKey[0])
+	}
+	users, err := jc.fetchAllPages(u, "")
+	if err != nil {
+		return nil, err
+	}
+	result := []User{}
+	for _, v := range users {
+		result = append(result, userFromIface(v))
+	}
+	return result, nil
+}
+
+//Builds the json reference to a user, by account id on Cloud and by name on Server.
+func (jc *JiraClient) userRef(user string) (msi, error) {
+	si, err := jc.GetServerInfo()
+	if err != nil {
+		return nil, err
+	}
+	if si.IsCloud() {
+		return msi{"accountId": user}, nil
+	}
+	return msi{"name": user}, nil
+}
+
+//Changes who reported an issue. user is a username on Server and an account id on Cloud.
+//The instance must allow modifying the reporter.
+func (jc *JiraClient) SetReporter(issueKey, user string) error {
+	ref, err := jc.userRef(user)
+	if err != nil {
+		return err
+	}
+	return jc.UpdateIssue(issueKey, msi{"reporter": []interface{}{msi{"set": ref}}})
+}
+
+//Lists the roles of a project, mapping each role name to its url.
+func (jc *JiraClient) GetProjectRoles(projectKey string) (map[string]string, error) {
+	obj, err := jc.getJson(fmt.Sprintf("%s/project/%s/role", jc.apiUrl(), url.PathEscape(projectKey)))
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]string{}
+	if roles, ok := obj.(map[string]interface{}); ok {
+		for name, u := range roles {
+			result[name], _ = u.(string)
+		}
+	}
+	return result, nil
+}
+
+//Lists the users holding a role in a project. roleID may also be the role url
+//returned by GetProjectRoles. Groups holding the role are left out.
+func (jc *JiraClient) GetProjectRoleMembers(projectKey, roleID string) ([]User, error) {
+	roleID = roleID[strings.LastIndex(roleID, "/")+1:]
+	obj, err := jc.getJson(fmt.Sprintf("%s/project/%s/role/%s", jc.apiUrl(), url.PathEscape(projectKey), roleID))
+	if err != nil {
+		return nil, err
+	}
+	actorsjs, _ := jsonWalker("actors", obj)
+	actors, _ := actorsjs.([]interface{})
+	result := []User{}
+	for _, a := range actors {
+		typejs, _ := jsonWalker("type", a)
+		if t, _ := typejs.(string); t != "atlassian-user-role-actor" {
+			continue
+		}
+		user := userFromIface(a)
+		if user.AccountId == "" {
+			accountjs, _ := jsonWalker("actorUser/accountId", a)
+			user.AccountId, _ = accountjs.(string)
+		}
+		if user.AccountId != "" {
+			//On Cloud the actor name is the account id, not a user name.
+			user.Name = ""
+		}
+		result = append(result, user)
+	}
+	return result, nil
+}
+
+//Finds the account id of the user with the given user name or email, for code
+//written against Server user names that has to run on Cloud. On Server, where
+//there are no account ids, the user name is returned. Cloud accounts hiding
+//their email can only be found by their exact display name.
+func (jc *JiraClient) ResolveAccountID(username string) (string, error) {
+	if id, ok := jc.accounts.get("name:" + username); ok {
+		return id, nil
+	}
+	users, err := jc.SearchUsers(username)
+	if err != nil {
+		return "", err
+	}
+	//The search matches prefixes too, only keep exact matches.
+	exact := []User{}
+	for _, u := range users {
+		if strings.EqualFold(u.Name, username) || strings.EqualFold(u.Email, username) {
+			exact = append(exact, u)
+		}
+	}
+	if len(exact) == 0 {
+		//Cloud accounts have no name and usually hide their email,
+		//fall back on their display name.
+		for _, u := range users {
+			if u.Name == "" && u.Email == "" && strings.EqualFold(u.DisplayName, username) {
+				exact = append(exact, u)
+			}
+		}
+	}
+	users = exact
+	switch len(users) {
+	case 0:
+		return "", &JiraClientError{fmt.Sprintf("No user matches %s", username)}
+	case 1:
+	default:
+		names := []string{}
+		for _, u := range users {
+			names = append(names, u.String())
+		}
+		return "", &JiraClientError{fmt.Sprintf("%s is ambiguous, it matches %s", username, strings.Join(names, ", "))}
+	}
+	id := users[0].Id()
+	jc.accounts.set("name:"+username, id)
+	return id, nil
+}
+
+//Finds the user name of an account, falling back to its email on Cloud where
+//users have no name. Fails if the account shows neither.
+func (jc *JiraClient) ResolveUsername(accountID string) (string, error) {
+	if name, ok := jc.accounts.get("id:" + accountID); ok {
+		return name, nil
+	}
+	obj, err := jc.getJson(fmt.Sprintf("%s/user?accountId=%s", jc.apiUrl(), url.QueryEscape(accountID)))
+	if err != nil {
+		return "", err
+	}
+	user := userFromIface(obj)
+	name := user.Name
+	if name == "" {
+		name = user.Email
+	}
+	if name == "" {
+		return "", &JiraClientError{fmt.Sprintf("Account %s has no user name or visible email", accountID)}
+	}
+	jc.accounts.set("id:"+accountID, name)
+	return name, nil
+}
+
+//Fetches the user the client is authenticated as.
+func (jc *JiraClient) GetCurrentUser() (*User, error) {
+	obj, err := jc.getJson(fmt.Sprintf("%s/myself", jc.apiUrl()))
+	if err != nil {
+		return nil, err
+	}
+	user := userFromIface(obj)
+	return &user, nil
+}
+
+//Adds a watcher to an issue. user is a user name on Server and an account id on Cloud.
+func (jc *JiraClient) AddWatcher(issueKey, user string) error {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return err
+	}
+	b, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	resp, err := jc.Post(fmt.Sprintf("%s/%s/watchers", jc.issueUrl(), issueKey), "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return newApiError(resp, "Could not add watcher")
+	}
+	return nil
+}
+
+//Removes a watcher from an issue. user is a user name on Server and an account id on Cloud.
+func (jc *JiraClient) RemoveWatcher(issueKey, user string) error {
+	if err := jc.checkIssueKey(issueKey); err != nil {
+		return err
+	}
+	si, err := jc.GetServerInfo()
+	if err != nil {
+		return err
+	}
+	param := "username"
+	if si.IsCloud() {
+		param = "accountId"
+	}
+	resp, err := jc.Delete(fmt.Sprintf("%s/%s/watchers?%s=%s", jc.issueUrl(), issueKey, param, url.QueryEscape(user)), "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return newApiError(resp, "Could not remove watcher")
+	}
+	return nil
+}
+
+//Makes the authenticated user watch an issue.
+func (jc *JiraClient) Watch(issueKey string) error {
+	me, err := jc.GetCurrentUser()
+	if err != nil {
+		return err
+	}
+	return jc.AddWatcher(issueKey, me.Id())
+}
+
+//Makes the authenticated user stop watching an issue.
+func (jc *JiraClient) Unwatch(issueKey string) error {
+	me, err := jc.GetCurrentUser()
+	if err != nil {
+		return err
+	}
+	return jc.RemoveWatcher(issueKey, me.Id())
+}
@@ -0,0 +1,53 @@
+package libgojira
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestResolveAccountID(t *testing.T) {
+	cases := []struct {
+		deployment string
+		query      string
+		users      []interface{}
+		want       string //Empty when the query must fail
+	}{
+		{"Server", "bob", []interface{}{
+			map[string]interface{}{"name": "bobby", "displayName": "Bobby Tables"},
+		}, ""},
+		{"Server", "bob", []interface{}{
+			map[string]interface{}{"name": "bobby", "displayName": "Bobby Tables"},
+			map[string]interface{}{"name": "Bob", "displayName": "Bob Smith"},
+		}, "Bob"},
+		{"Cloud", "bob@example.com", []interface{}{
+			map[string]interface{}{"accountId": "1", "displayName": "Bob Smith", "emailAddress": "bob@example.com"},
+		}, "1"},
+		{"Cloud", "bo", []interface{}{
+			map[string]interface{}{"accountId": "2", "displayName": "Bobby Tables"},
+		}, ""},
+		{"Cloud", "bobby tables", []interface{}{
+			map[string]interface{}{"accountId": "2", "displayName": "Bobby Tables"},
+		}, "2"},
+		{"Cloud", "Bobby Tables", []interface{}{
+			map[string]interface{}{"accountId": "2", "displayName": "Bobby Tables"},
+			map[string]interface{}{"accountId": "3", "displayName": "Bobby Tables"},
+		}, ""},
+	}
+	for _, c := range cases {
+		jc, _ := newTestClient(t, Options{}, func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/serverInfo") {
+				writeJson(t, w, map[string]interface{}{"deploymentType": c.deployment})
+				return
+			}
+			writeJson(t, w, c.users)
+		})
+		got, err := jc.ResolveAccountID(c.query)
+		if c.want == "" && err == nil {
+			t.Errorf("%s, %q: resolved to %q, want an error", c.deployment, c.query, got)
+		}
+		if c.want != "" && got != c.want {
+			t.Errorf("%s, %q: got %q, %v, want %q", c.deployment, c.query, got, err, c.want)
+		}
+	}
+}